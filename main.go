@@ -12,26 +12,38 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	clientset "github.com/openfaas/faas-netes/pkg/client/clientset/versioned"
 	informers "github.com/openfaas/faas-netes/pkg/client/informers/externalversions"
 	"github.com/openfaas/faas-netes/pkg/config"
 	"github.com/openfaas/faas-netes/pkg/handlers"
+	"github.com/openfaas/faas-netes/pkg/imageverify"
 	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/logs"
+	"github.com/openfaas/faas-netes/pkg/logshipper"
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	"github.com/openfaas/faas-netes/pkg/proxy"
+	"github.com/openfaas/faas-netes/pkg/secretbackend"
 	"github.com/openfaas/faas-netes/pkg/signals"
 	version "github.com/openfaas/faas-netes/version"
 	faasProvider "github.com/openfaas/faas-provider"
-	"github.com/openfaas/faas-provider/logs"
-	"github.com/openfaas/faas-provider/proxy"
+	"github.com/openfaas/faas-provider/auth"
 	providertypes "github.com/openfaas/faas-provider/types"
+	"github.com/prometheus/client_golang/prometheus"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	kubeinformers "k8s.io/client-go/informers"
 	v1apps "k8s.io/client-go/informers/apps/v1"
 	v1core "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	v1appslisters "k8s.io/client-go/listers/apps/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	clientmetrics "k8s.io/client-go/tools/metrics"
 	"k8s.io/klog"
 
 	// required to authenticate against GKE clusters
@@ -42,7 +54,22 @@ import (
 
 const defaultResync = time.Hour * 10
 
+// functionUsageTTL is how long function usage from metrics.k8s.io is cached for
+const functionUsageTTL = time.Second * 10
+
+// logShipperResync is how often the log shipper checks for new functions to tail
+const logShipperResync = time.Second * 30
+
 func main() {
+	// the decrypt-secrets command is run as an init container by functions with
+	// encrypted secrets
+	if len(os.Args) > 1 && os.Args[1] == "decrypt-secrets" {
+		if err := decryptSecrets(os.Args[2:]); err != nil {
+			log.Fatalf("Error decrypting secrets: %s", err.Error())
+		}
+		return
+	}
+
 	var kubeconfig string
 	var masterURL string
 	var (
@@ -72,6 +99,10 @@ Version: %s Commit: %s
 		log.Fatalf("Error checking connectivity, OpenFaaS CE cannot be run in an offline environment: %s", err.Error())
 	}
 
+	// record the latency of requests to the Kubernetes API for the telemetry endpoint
+	apiLatency := metrics.NewAPILatency()
+	clientmetrics.Register(clientmetrics.RegisterOpts{RequestLatency: apiLatency})
+
 	clientCmdConfig, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %s", err.Error())
@@ -98,19 +129,42 @@ Version: %s Commit: %s
 	config.Fprint(verbose)
 
 	deployConfig := k8s.DeploymentConfig{
-		RuntimeHTTPPort: 8080,
-		HTTPProbe:       config.HTTPProbe,
-		SetNonRootUser:  config.SetNonRootUser,
-		ReadinessProbe: &k8s.ProbeConfig{
-			InitialDelaySeconds: int32(2),
-			TimeoutSeconds:      int32(1),
-			PeriodSeconds:       int32(2),
-		},
-		LivenessProbe: &k8s.ProbeConfig{
-			InitialDelaySeconds: int32(2),
-			TimeoutSeconds:      int32(1),
-			PeriodSeconds:       int32(2),
-		},
+		RuntimeHTTPPort:      int32(config.RuntimeHTTPPort),
+		HTTPProbe:            config.HTTPProbe,
+		SetNonRootUser:       config.SetNonRootUser,
+		MaxFunctionTimeout:   config.FaaSConfig.WriteTimeout,
+		ReadinessProbe:       probeConfig(config.ReadinessProbe),
+		LivenessProbe:        probeConfig(config.LivenessProbe),
+		ImagePullPolicy:      corev1.PullPolicy(config.ImagePullPolicy),
+		RevisionHistoryLimit: int32(config.RevisionHistoryLimit),
+		ResolveImageDigests:  config.ResolveImageDigests,
+		DefaultRequests:      resourceList(config.DefaultRequests),
+		DefaultLimits:        resourceList(config.DefaultLimits),
+	}
+
+	if config.ImageVerification.Mode != "" {
+		keys, err := imageverify.LoadPublicKeys(config.ImageVerification.PublicKeys)
+		if err != nil {
+			log.Fatalf("Error loading image verification keys: %s", err.Error())
+		}
+
+		verifier, err := imageverify.New(config.ImageVerification.Mode, keys, config.ImageVerification.PredicateType)
+		if err != nil {
+			log.Fatalf("Error configuring image verification: %s", err.Error())
+		}
+		deployConfig.ImageVerifier = verifier
+	}
+
+	if config.SecretEncryption.KEK != "" {
+		deployConfig.SecretDecryption = &k8s.SecretDecryptionConfig{
+			Image:            config.SecretEncryption.DecryptImage,
+			KEK:              config.SecretEncryption.KEK,
+			KEKFile:          config.SecretEncryption.KEKFile,
+			KEKHostPath:      config.SecretEncryption.KEKHostPath,
+			VaultAddr:        config.SecretEncryption.VaultAddr,
+			VaultKey:         config.SecretEncryption.VaultKey,
+			VaultTokenSecret: config.SecretEncryption.VaultTokenSecret,
+		}
 	}
 
 	namespaceScope := config.DefaultFunctionNamespace
@@ -134,6 +188,7 @@ Version: %s Commit: %s
 		faasInformerFactory: faasInformerFactory,
 		kubeClient:          kubeClient,
 		faasClient:          faasClient,
+		apiLatency:          apiLatency,
 	}
 
 	runController(setup)
@@ -177,12 +232,48 @@ func runController(setup serverSetup) {
 	listers := startInformers(setup, stopCh, operator)
 	handlers.RegisterEventHandlers(listers.DeploymentInformer, kubeClient, config.DefaultFunctionNamespace)
 	deployLister := listers.DeploymentInformer.Lister()
-	functionLookup := k8s.NewFunctionLookup(config.DefaultFunctionNamespace, listers.EndpointsInformer.Lister())
+	functionLookup := k8s.NewFunctionLookup(config.DefaultFunctionNamespace, listers.EndpointsInformer.Lister(), int32(config.RuntimeHTTPPort))
 	functionList := k8s.NewFunctionList(config.DefaultFunctionNamespace, deployLister)
+	functionAnnotations := k8s.NewFunctionAnnotationLookup(config.DefaultFunctionNamespace, deployLister)
+	podWatcher := k8s.NewPodWatcher(kubeClient, stopCh)
+
+	enabledNamespaces := func() []string {
+		return handlers.ListNamespaces(config.DefaultFunctionNamespace, kubeClient)
+	}
+	secretRollout := k8s.NewSecretRollout(kubeClient, config.DefaultFunctionNamespace, enabledNamespaces, deployLister)
+	go secretRollout.Run(stopCh)
+
+	if len(config.LogExport.Sinks) > 0 {
+		startLogShipper(setup, podWatcher, deployLister, stopCh)
+	}
+
+	secrets := k8s.NewSecretsClient(kubeClient)
+	if config.SecretEncryption.KEK != "" {
+		encryption := config.SecretEncryption
+		kek, err := k8s.NewKeyEncryptionKey(encryption.KEK, encryption.KEKFile, encryption.VaultAddr, encryption.VaultToken, encryption.VaultKey)
+		if err != nil {
+			log.Fatalf("Error creating key encryption key: %s", err.Error())
+		}
+
+		log.Printf("Encrypting function secrets with key: %s\n", kek.ID())
+		secrets = k8s.NewEncryptedSecretsClient(kubeClient, kek)
+	}
+
+	if config.SecretBackend.Backend != "" {
+		secrets = startSecretBackend(setup, stopCh)
+	}
+
+	informersSynced := map[string]cache.InformerSynced{
+		"deployments": listers.DeploymentInformer.Informer().HasSynced,
+		"endpoints":   listers.EndpointsInformer.Informer().HasSynced,
+	}
 
 	printFunctionExecutionTime := true
 
-	proxyHandler := proxy.NewHandlerFunc(config.FaaSConfig, functionLookup, printFunctionExecutionTime)
+	invocationMetrics := metrics.NewInvocationMetrics(config.DefaultFunctionNamespace, prometheus.DefaultRegisterer)
+	functionUsage := k8s.NewFunctionUsageReader(kubeClient, functionUsageTTL)
+
+	proxyHandler := proxy.NewHandlerFunc(config.FaaSConfig, functionLookup, functionAnnotations, invocationMetrics, printFunctionExecutionTime)
 
 	if err := handlers.Check(functionList); err != nil {
 		msg := fmt.Sprintf("Function invocations disabled due to error: %s.", err.Error())
@@ -197,22 +288,169 @@ func runController(setup serverSetup) {
 		FunctionProxy:  proxyHandler,
 		DeleteFunction: handlers.MakeDeleteHandler(config.DefaultFunctionNamespace, kubeClient),
 		DeployFunction: handlers.MakeDeployHandler(config.DefaultFunctionNamespace, factory, functionList),
-		FunctionLister: handlers.MakeFunctionReader(config.DefaultFunctionNamespace, deployLister),
-		FunctionStatus: handlers.MakeReplicaReader(config.DefaultFunctionNamespace, deployLister),
+		FunctionLister: handlers.MakeFunctionReader(config.DefaultFunctionNamespace, deployLister, invocationMetrics, functionUsage),
+		FunctionStatus: handlers.MakeReplicaReader(config.DefaultFunctionNamespace, deployLister, invocationMetrics, functionUsage),
 		ScaleFunction:  handlers.MakeReplicaUpdater(config.DefaultFunctionNamespace, kubeClient),
 		UpdateFunction: handlers.MakeUpdateHandler(config.DefaultFunctionNamespace, factory),
 		Health:         handlers.MakeHealthHandler(),
 		Info:           handlers.MakeInfoHandler(version.BuildVersion(), version.GitCommit),
-		Secrets:        handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient),
-		Logs:           logs.NewLogHandlerFunc(k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace), config.FaaSConfig.WriteTimeout),
+		Secrets:        handlers.MakeSecretHandler(config.DefaultFunctionNamespace, kubeClient, secrets, deployLister),
+		Logs:           logs.NewLogHandlerFunc(k8s.NewLogRequestor(kubeClient, config.DefaultFunctionNamespace, podWatcher), config.FaaSConfig.WriteTimeout),
 		ListNamespaces: handlers.MakeNamespacesLister(config.DefaultFunctionNamespace, kubeClient),
+		Telemetry:      handlers.MakeTelemetryHandler(config.DefaultFunctionNamespace, deployLister, invocationMetrics, informersSynced, setup.apiLatency),
+	}
+
+	registryCredentials := handlers.MakeRegistryCredentialsHandler(config.DefaultFunctionNamespace, kubeClient, deployLister)
+	if config.FaaSConfig.EnableBasicAuth {
+		registryCredentials = withBasicAuth(config.FaaSConfig, registryCredentials)
 	}
 
+	// routes which are not part of the faas-provider handlers
+	faasProvider.Router().HandleFunc("/system/registry-credentials", registryCredentials).
+		Methods(http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+
 	ctx := context.Background()
 
 	faasProvider.Serve(ctx, &bootstrapHandlers, &config.FaaSConfig)
 }
 
+// probeConfig converts the probe timings read from the environment for the factory
+func probeConfig(probe config.ProbeConfig) *k8s.ProbeConfig {
+	return &k8s.ProbeConfig{
+		InitialDelaySeconds: int32(probe.InitialDelaySeconds),
+		TimeoutSeconds:      int32(probe.TimeoutSeconds),
+		PeriodSeconds:       int32(probe.PeriodSeconds),
+		SuccessThreshold:    int32(probe.SuccessThreshold),
+		FailureThreshold:    int32(probe.FailureThreshold),
+	}
+}
+
+// resourceList converts default resources, which were validated by config.ReadConfig
+func resourceList(resources providertypes.FunctionResources) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if resources.Memory != "" {
+		list[corev1.ResourceMemory] = resource.MustParse(resources.Memory)
+	}
+	if resources.CPU != "" {
+		list[corev1.ResourceCPU] = resource.MustParse(resources.CPU)
+	}
+	return list
+}
+
+// withBasicAuth protects a handler which is registered outside of faas-provider with the
+// same credentials as the provider's own handlers
+func withBasicAuth(faasConfig providertypes.FaaSConfig, next http.HandlerFunc) http.HandlerFunc {
+	reader := auth.ReadBasicAuthFromDisk{
+		SecretMountPath: faasConfig.SecretMountPath,
+	}
+
+	credentials, err := reader.Read()
+	if err != nil {
+		log.Fatalf("Error reading basic auth credentials: %s", err.Error())
+	}
+
+	return auth.DecorateWithBasicAuth(next, credentials)
+}
+
+// startLogShipper ships the logs of all functions to the configured sinks until stopCh is closed
+func startLogShipper(setup serverSetup, podWatcher *k8s.PodWatcher, deployLister v1appslisters.DeploymentLister, stopCh <-chan struct{}) {
+	exportConfig := setup.config.LogExport
+
+	sinks, err := logshipper.NewSinks(exportConfig.Sinks, logshipper.SinkConfig{
+		File:           exportConfig.File,
+		FileMaxBytes:   exportConfig.FileMaxBytes,
+		FileMaxBackups: exportConfig.FileMaxBackups,
+		LokiURL:        exportConfig.LokiURL,
+		OTLPURL:        exportConfig.OTLPURL,
+	})
+	if err != nil {
+		log.Fatalf("Error creating log export sinks: %s", err.Error())
+	}
+
+	shipper := logshipper.New(setup.kubeClient, podWatcher, deployLister, sinks, logshipper.Config{
+		Namespace:      setup.config.DefaultFunctionNamespace,
+		BufferSize:     exportConfig.BufferSize,
+		BatchSize:      exportConfig.BatchSize,
+		FlushInterval:  exportConfig.FlushInterval,
+		ResyncInterval: logShipperResync,
+		Overflow:       logshipper.OverflowPolicy(exportConfig.Overflow),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	log.Printf("Shipping function logs to: %v\n", exportConfig.Sinks)
+	go shipper.Run(ctx)
+}
+
+// startSecretBackend syncs the secrets of the configured backend into Kubernetes until
+// stopCh is closed, and returns a SecretsClient which writes through to the backend
+func startSecretBackend(setup serverSetup, stopCh <-chan struct{}) k8s.SecretsClient {
+	backendConfig := setup.config.SecretBackend
+
+	backend, err := secretbackend.New(secretbackend.Config{
+		Backend:     backendConfig.Backend,
+		FileDir:     backendConfig.FileDir,
+		VaultAddr:   backendConfig.VaultAddr,
+		VaultToken:  backendConfig.VaultToken,
+		VaultMount:  backendConfig.VaultMount,
+		VaultPrefix: backendConfig.VaultPrefix,
+	})
+	if err != nil {
+		log.Fatalf("Error creating secret backend: %s", err.Error())
+	}
+
+	namespaces := func() []string {
+		return handlers.ListNamespaces(setup.config.DefaultFunctionNamespace, setup.kubeClient)
+	}
+	secretSync := k8s.NewSecretSync(setup.kubeClient, backend, namespaces, backendConfig.SyncInterval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	log.Printf("Storing function secrets in: %s\n", backend.Name())
+	go secretSync.Run(ctx)
+
+	return k8s.NewBackendSecretsClient(setup.kubeClient, backend)
+}
+
+// decryptSecrets decrypts the secrets projected into the src directory and writes them
+// to dst. The key encryption key is configured with the same environment variables as
+// faas-netes.
+func decryptSecrets(args []string) error {
+	flags := flag.NewFlagSet("decrypt-secrets", flag.ExitOnError)
+	src := flags.String("src", "", "Directory of the projected secrets")
+	dst := flags.String("dst", "", "Directory to write the decrypted secrets to")
+	dirs := flags.String("directories", "", "Comma separated secrets to write as a directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	directories := map[string]bool{}
+	for _, name := range strings.Split(*dirs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			directories[name] = true
+		}
+	}
+
+	kek, err := k8s.NewKeyEncryptionKey(os.Getenv("secret_encryption_kek"),
+		os.Getenv("secret_encryption_kek_file"),
+		os.Getenv("secret_encryption_vault_addr"),
+		os.Getenv("secret_encryption_vault_token"),
+		os.Getenv("secret_encryption_vault_key"))
+	if err != nil {
+		return err
+	}
+
+	return k8s.DecryptSecretsDir(kek, *src, *dst, directories)
+}
+
 // serverSetup is a container for the config and clients needed to start the
 // faas-netes controller or operator
 type serverSetup struct {
@@ -222,4 +460,5 @@ type serverSetup struct {
 	functionFactory     k8s.FunctionFactory
 	kubeInformerFactory kubeinformers.SharedInformerFactory
 	faasInformerFactory informers.SharedInformerFactory
+	apiLatency          *metrics.APILatency
 }
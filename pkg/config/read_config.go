@@ -6,9 +6,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	ftypes "github.com/openfaas/faas-provider/types"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // ReadConfig constitutes config from env variables
@@ -34,9 +39,224 @@ func (ReadConfig) Read(hasEnv ftypes.HasEnv) (BootstrapConfig, error) {
 	cfg.HTTPProbe = httpProbe
 	cfg.SetNonRootUser = setNonRootUser
 
+	if cfg.RuntimeHTTPPort, err = parseIntEnv(hasEnv, "runtime_http_port", 8080, 1, 65535); err != nil {
+		return cfg, err
+	}
+
+	if cfg.ReadinessProbe, err = readProbeConfig(hasEnv, "readiness_probe"); err != nil {
+		return cfg, err
+	}
+
+	if cfg.LivenessProbe, err = readProbeConfig(hasEnv, "liveness_probe"); err != nil {
+		return cfg, err
+	}
+
+	if cfg.LivenessProbe.SuccessThreshold != 1 {
+		return cfg, fmt.Errorf("liveness_probe_success_threshold must be 1, got: %d", cfg.LivenessProbe.SuccessThreshold)
+	}
+
+	cfg.ImagePullPolicy = ftypes.ParseString(hasEnv.Getenv("image_pull_policy"), "Always")
+	switch cfg.ImagePullPolicy {
+	case "Always", "IfNotPresent", "Never":
+	default:
+		return cfg, fmt.Errorf("image_pull_policy must be Always, IfNotPresent or Never, got: %q", cfg.ImagePullPolicy)
+	}
+
+	if cfg.RevisionHistoryLimit, err = parseIntEnv(hasEnv, "revision_history_limit", 10, 0, 1000); err != nil {
+		return cfg, err
+	}
+
+	cfg.ResolveImageDigests = ftypes.ParseBoolValue(hasEnv.Getenv("resolve_image_digests"), false)
+
+	cfg.ImageVerification = ImageVerificationConfig{
+		Mode:          hasEnv.Getenv("image_verification"),
+		PublicKeys:    ftypes.ParseString(hasEnv.Getenv("image_verification_public_keys"), "/var/openfaas/image-verification/cosign.pub"),
+		PredicateType: hasEnv.Getenv("image_verification_predicate_type"),
+	}
+
+	switch cfg.ImageVerification.Mode {
+	case "", "signature":
+		if cfg.ImageVerification.PredicateType != "" {
+			return cfg, fmt.Errorf("image_verification_predicate_type requires image_verification to be attestation")
+		}
+	case "attestation":
+	default:
+		return cfg, fmt.Errorf("image_verification must be signature or attestation, got: %q", cfg.ImageVerification.Mode)
+	}
+
+	cfg.DefaultRequests = ftypes.FunctionResources{
+		Memory: hasEnv.Getenv("default_requests_memory"),
+		CPU:    hasEnv.Getenv("default_requests_cpu"),
+	}
+	cfg.DefaultLimits = ftypes.FunctionResources{
+		Memory: hasEnv.Getenv("default_limits_memory"),
+		CPU:    hasEnv.Getenv("default_limits_cpu"),
+	}
+
+	if err := validateDefaultResources(cfg.DefaultRequests, cfg.DefaultLimits); err != nil {
+		return cfg, err
+	}
+
+	cfg.LogExport = LogExportConfig{
+		File:           ftypes.ParseString(hasEnv.Getenv("log_export_file"), "/var/log/openfaas/functions.log"),
+		FileMaxBytes:   int64(ftypes.ParseIntValue(hasEnv.Getenv("log_export_file_max_mb"), 100)) * 1024 * 1024,
+		FileMaxBackups: ftypes.ParseIntValue(hasEnv.Getenv("log_export_file_max_backups"), 3),
+		LokiURL:        hasEnv.Getenv("log_export_loki_url"),
+		OTLPURL:        hasEnv.Getenv("log_export_otlp_url"),
+		FlushInterval:  ftypes.ParseIntOrDurationValue(hasEnv.Getenv("log_export_flush_interval"), time.Second*5),
+		Overflow:       ftypes.ParseString(hasEnv.Getenv("log_export_overflow"), "drop"),
+	}
+
+	for _, sink := range strings.Split(hasEnv.Getenv("log_export_sinks"), ",") {
+		if sink = strings.TrimSpace(sink); sink != "" {
+			cfg.LogExport.Sinks = append(cfg.LogExport.Sinks, sink)
+		}
+	}
+
+	if cfg.LogExport.Overflow != "drop" && cfg.LogExport.Overflow != "block" {
+		return cfg, fmt.Errorf("log_export_overflow must be drop or block, got: %q", cfg.LogExport.Overflow)
+	}
+
+	if cfg.LogExport.BufferSize, err = parseIntEnv(hasEnv, "log_export_buffer_size", 10000, 1, 1000000); err != nil {
+		return cfg, err
+	}
+	if cfg.LogExport.BatchSize, err = parseIntEnv(hasEnv, "log_export_batch_size", 500, 1, 1000000); err != nil {
+		return cfg, err
+	}
+	if cfg.LogExport.FlushInterval <= 0 {
+		return cfg, fmt.Errorf("log_export_flush_interval must be greater than zero, got: %q", hasEnv.Getenv("log_export_flush_interval"))
+	}
+
+	cfg.SecretBackend = SecretBackendConfig{
+		Backend:      hasEnv.Getenv("secret_backend"),
+		FileDir:      ftypes.ParseString(hasEnv.Getenv("secret_backend_file_dir"), "/var/lib/openfaas/secrets"),
+		VaultAddr:    hasEnv.Getenv("secret_backend_vault_addr"),
+		VaultToken:   hasEnv.Getenv("secret_backend_vault_token"),
+		VaultMount:   ftypes.ParseString(hasEnv.Getenv("secret_backend_vault_mount"), "secret"),
+		VaultPrefix:  ftypes.ParseString(hasEnv.Getenv("secret_backend_vault_prefix"), "openfaas"),
+		SyncInterval: ftypes.ParseIntOrDurationValue(hasEnv.Getenv("secret_backend_sync_interval"), time.Second*30),
+	}
+
+	switch cfg.SecretBackend.Backend {
+	case "", "file", "vault":
+	default:
+		return cfg, fmt.Errorf("secret_backend must be file or vault, got: %q", cfg.SecretBackend.Backend)
+	}
+
+	if cfg.SecretBackend.Backend != "" && cfg.SecretBackend.SyncInterval <= 0 {
+		return cfg, fmt.Errorf("secret_backend_sync_interval must be greater than zero, got: %q", hasEnv.Getenv("secret_backend_sync_interval"))
+	}
+
+	cfg.SecretEncryption = SecretEncryptionConfig{
+		KEK:              hasEnv.Getenv("secret_encryption_kek"),
+		KEKFile:          ftypes.ParseString(hasEnv.Getenv("secret_encryption_kek_file"), "/var/openfaas/kek/kek"),
+		KEKHostPath:      hasEnv.Getenv("secret_encryption_kek_host_path"),
+		VaultAddr:        hasEnv.Getenv("secret_encryption_vault_addr"),
+		VaultKey:         hasEnv.Getenv("secret_encryption_vault_key"),
+		VaultToken:       hasEnv.Getenv("secret_encryption_vault_token"),
+		VaultTokenSecret: ftypes.ParseString(hasEnv.Getenv("secret_encryption_vault_token_secret"), "openfaas-secrets-vault-token"),
+		DecryptImage:     hasEnv.Getenv("secret_encryption_decrypt_image"),
+	}
+
+	switch cfg.SecretEncryption.KEK {
+	case "":
+	case "file", "vault-transit":
+		if cfg.SecretEncryption.DecryptImage == "" {
+			return cfg, fmt.Errorf("secret_encryption_decrypt_image is required when secret_encryption_kek is set")
+		}
+		if cfg.SecretBackend.Backend != "" {
+			return cfg, fmt.Errorf("secret_encryption_kek can not be combined with secret_backend")
+		}
+		if cfg.SecretEncryption.KEK == "file" && cfg.SecretEncryption.KEKHostPath == "" {
+			return cfg, fmt.Errorf("secret_encryption_kek_host_path is required when secret_encryption_kek is file")
+		}
+	default:
+		return cfg, fmt.Errorf("secret_encryption_kek must be file or vault-transit, got: %q", cfg.SecretEncryption.KEK)
+	}
+
 	return cfg, nil
 }
 
+// parseIntEnv parses an optional integer from the environment, which must be between
+// min and max inclusive. Unlike ftypes.ParseIntValue, invalid values are an error.
+func parseIntEnv(hasEnv ftypes.HasEnv, key string, fallback, min, max int) (int, error) {
+	val := strings.TrimSpace(hasEnv.Getenv(key))
+	if val == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed < min || parsed > max {
+		return fallback, fmt.Errorf("%s must be a whole number between %d and %d, got: %q", key, min, max, val)
+	}
+
+	return parsed, nil
+}
+
+// readProbeConfig reads the timings of a probe from environment variables which
+// start with prefix, i.e. readiness_probe_period_seconds
+func readProbeConfig(hasEnv ftypes.HasEnv, prefix string) (ProbeConfig, error) {
+	probe := ProbeConfig{}
+
+	fields := []struct {
+		name     string
+		target   *int
+		fallback int
+		min      int
+	}{
+		{"initial_delay_seconds", &probe.InitialDelaySeconds, 2, 0},
+		{"timeout_seconds", &probe.TimeoutSeconds, 1, 1},
+		{"period_seconds", &probe.PeriodSeconds, 2, 1},
+		{"success_threshold", &probe.SuccessThreshold, 1, 1},
+		{"failure_threshold", &probe.FailureThreshold, 3, 1},
+	}
+
+	for _, field := range fields {
+		v, err := parseIntEnv(hasEnv, prefix+"_"+field.name, field.fallback, field.min, 3600)
+		if err != nil {
+			return probe, err
+		}
+		*field.target = v
+	}
+
+	return probe, nil
+}
+
+// validateDefaultResources checks that the default resources can be parsed, and that
+// a default request does not exceed the default limit for the same resource
+func validateDefaultResources(requests, limits ftypes.FunctionResources) error {
+	pairs := []struct {
+		name           string
+		request, limit string
+	}{
+		{"memory", requests.Memory, limits.Memory},
+		{"cpu", requests.CPU, limits.CPU},
+	}
+
+	for _, pair := range pairs {
+		var request, limit resource.Quantity
+		var err error
+
+		if pair.request != "" {
+			if request, err = resource.ParseQuantity(pair.request); err != nil {
+				return fmt.Errorf("default_requests_%s is invalid: %s", pair.name, err.Error())
+			}
+		}
+
+		if pair.limit != "" {
+			if limit, err = resource.ParseQuantity(pair.limit); err != nil {
+				return fmt.Errorf("default_limits_%s is invalid: %s", pair.name, err.Error())
+			}
+		}
+
+		if pair.request != "" && pair.limit != "" && request.Cmp(limit) > 0 {
+			return fmt.Errorf("default_requests_%s of %s exceeds default_limits_%s of %s", pair.name, pair.request, pair.name, pair.limit)
+		}
+	}
+
+	return nil
+}
+
 // BootstrapConfig contains the server configuration values as well as default
 // Function configuration parameters that are passed to the function factory.
 type BootstrapConfig struct {
@@ -48,6 +268,34 @@ type BootstrapConfig struct {
 	// non-root user id.  Currently this is preconfigured to the uid 12000.
 	SetNonRootUser bool
 
+	// RuntimeHTTPPort is the port which the watchdog of each function listens on
+	RuntimeHTTPPort int
+
+	// ReadinessProbe holds the default timings of the readiness probe of functions
+	ReadinessProbe ProbeConfig
+
+	// LivenessProbe holds the default timings of the liveness probe of functions
+	LivenessProbe ProbeConfig
+
+	// ImagePullPolicy is the pull policy of function containers, one of Always,
+	// IfNotPresent or Never
+	ImagePullPolicy string
+
+	// RevisionHistoryLimit is the number of old ReplicaSets kept for each function
+	RevisionHistoryLimit int
+
+	// ResolveImageDigests pins function images to the digest of their tag at deploy time
+	ResolveImageDigests bool
+
+	// ImageVerification configures the verification of image signatures before deploy
+	ImageVerification ImageVerificationConfig
+
+	// DefaultRequests are applied to functions which do not request memory or CPU
+	DefaultRequests ftypes.FunctionResources
+
+	// DefaultLimits are applied to functions which do not set a memory or CPU limit
+	DefaultLimits ftypes.FunctionResources
+
 	// DefaultFunctionNamespace defines which namespace in which Functions are deployed.
 	// Value is set via the function_namespace environment variable. If the
 	// variable is not set, it is set to "default".
@@ -55,6 +303,135 @@ type BootstrapConfig struct {
 
 	// FaaSConfig contains the configuration for the FaaSProvider
 	FaaSConfig ftypes.FaaSConfig
+
+	// LogExport configures the shipping of function logs to external sinks
+	LogExport LogExportConfig
+
+	// SecretBackend configures an external store for function secrets
+	SecretBackend SecretBackendConfig
+
+	// SecretEncryption configures envelope encryption of the values of function secrets
+	SecretEncryption SecretEncryptionConfig
+}
+
+// ProbeConfig holds the timings of a probe, read from environment variables prefixed
+// with readiness_probe_ or liveness_probe_
+type ProbeConfig struct {
+	InitialDelaySeconds int
+	TimeoutSeconds      int
+	PeriodSeconds       int
+	SuccessThreshold    int
+	FailureThreshold    int
+}
+
+// ImageVerificationConfig configures the verification of function images, which is
+// enabled by setting image_verification to signature or attestation. Images are checked
+// for cosign signatures or attestations made with one of the public keys.
+type ImageVerificationConfig struct {
+	// Mode is empty, "signature" or "attestation"
+	Mode string
+
+	// PublicKeys is the path to a file of one or more PEM encoded public keys
+	PublicKeys string
+
+	// PredicateType is the in-toto predicate type which an attestation must have,
+	// any type is accepted when empty
+	PredicateType string
+}
+
+// SecretEncryptionConfig configures envelope encryption of function secrets, which is
+// enabled by setting secret_encryption_kek to file or vault-transit. Each secret is
+// encrypted with its own data key, which is wrapped by the key encryption key (KEK).
+// Functions with encrypted secrets run an init container to decrypt them.
+type SecretEncryptionConfig struct {
+	// KEK is empty, "file" or "vault-transit"
+	KEK string
+
+	// KEKFile is the path to the base64 encoded AES-256 key for the file KEK
+	KEKFile string
+
+	// KEKHostPath is a directory on each node which holds the file KEK for the init
+	// container, under the base name of KEKFile. It is provisioned outside of Kubernetes,
+	// such as by the nodes' configuration management, so that the KEK is never stored in
+	// etcd alongside the secrets it encrypts.
+	KEKHostPath string
+
+	// VaultAddr is the address of Vault for the vault-transit KEK
+	VaultAddr string
+
+	// VaultKey is the name of the key within the transit secrets engine
+	VaultKey string
+
+	// VaultToken is used by faas-netes to encrypt with the transit key
+	VaultToken string
+
+	// VaultTokenSecret is the Secret in each function namespace with a "token" key,
+	// used by the init container to decrypt with the transit key
+	VaultTokenSecret string
+
+	// DecryptImage is the faas-netes image run as the init container
+	DecryptImage string
+}
+
+// SecretBackendConfig configures an external store for function secrets, which is
+// enabled by setting the secret_backend environment variable to file or vault. When
+// unset, secrets are stored only as Kubernetes Secrets.
+type SecretBackendConfig struct {
+	// Backend is empty, "file" or "vault"
+	Backend string
+
+	// FileDir is the directory used by the file backend
+	FileDir string
+
+	// VaultAddr is the address of the Vault server
+	VaultAddr string
+
+	// VaultToken authenticates to Vault
+	VaultToken string
+
+	// VaultMount is the path of the KV version 2 secrets engine
+	VaultMount string
+
+	// VaultPrefix is prepended to the path of each secret within the mount
+	VaultPrefix string
+
+	// SyncInterval is how often secrets are copied from the backend into Kubernetes
+	SyncInterval time.Duration
+}
+
+// LogExportConfig configures the log shipper, which is enabled when at least one
+// sink is set via the comma separated log_export_sinks environment variable.
+type LogExportConfig struct {
+	// Sinks are the names of the sinks to ship logs to: stdout, file, loki or otlp
+	Sinks []string
+
+	// File is the path written to by the file sink
+	File string
+
+	// FileMaxBytes is the size at which the file is rotated
+	FileMaxBytes int64
+
+	// FileMaxBackups is the number of rotated files to keep
+	FileMaxBackups int
+
+	// LokiURL is the push endpoint for the loki sink
+	LokiURL string
+
+	// OTLPURL is the OTLP/HTTP logs endpoint for the otlp sink
+	OTLPURL string
+
+	// BufferSize is the number of messages buffered for each sink
+	BufferSize int
+
+	// BatchSize is the maximum number of messages written to a sink at once
+	BatchSize int
+
+	// FlushInterval is the maximum time a message is buffered
+	FlushInterval time.Duration
+
+	// Overflow is either "drop" or "block" and decides what happens when a sink is
+	// too slow and its buffer is full
+	Overflow string
 }
 
 // Fprint pretty-prints the config with the stdlib logger. One line per config value.
@@ -64,7 +441,7 @@ func (c BootstrapConfig) Fprint(verbose bool) {
 	log.Printf("HTTP Read Timeout: %s\n", c.FaaSConfig.GetReadTimeout())
 	log.Printf("HTTP Write Timeout: %s\n", c.FaaSConfig.WriteTimeout)
 
-	log.Printf("ImagePullPolicy: %s\n", "Always")
+	log.Printf("ImagePullPolicy: %s\n", c.ImagePullPolicy)
 	log.Printf("DefaultFunctionNamespace: %s\n", c.DefaultFunctionNamespace)
 
 	if verbose {
@@ -72,5 +449,16 @@ func (c BootstrapConfig) Fprint(verbose bool) {
 		log.Printf("MaxIdleConnsPerHost: %d\n", c.FaaSConfig.MaxIdleConnsPerHost)
 		log.Printf("HTTPProbe: %v\n", c.HTTPProbe)
 		log.Printf("SetNonRootUser: %v\n", c.SetNonRootUser)
+		log.Printf("RuntimeHTTPPort: %d\n", c.RuntimeHTTPPort)
+		log.Printf("ReadinessProbe: %+v\n", c.ReadinessProbe)
+		log.Printf("LivenessProbe: %+v\n", c.LivenessProbe)
+		log.Printf("RevisionHistoryLimit: %d\n", c.RevisionHistoryLimit)
+		log.Printf("ResolveImageDigests: %v\n", c.ResolveImageDigests)
+		log.Printf("ImageVerification: %s\n", c.ImageVerification.Mode)
+		log.Printf("DefaultRequests: memory=%q cpu=%q\n", c.DefaultRequests.Memory, c.DefaultRequests.CPU)
+		log.Printf("DefaultLimits: memory=%q cpu=%q\n", c.DefaultLimits.Memory, c.DefaultLimits.CPU)
+		log.Printf("LogExportSinks: %v\n", c.LogExport.Sinks)
+		log.Printf("SecretBackend: %s\n", c.SecretBackend.Backend)
+		log.Printf("SecretEncryptionKEK: %s\n", c.SecretEncryption.KEK)
 	}
 }
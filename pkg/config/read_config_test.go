@@ -72,3 +72,216 @@ func TestRead_HTTPProbeConfig_true(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRead_LogExportDisabledByDefault(t *testing.T) {
+	config, err := ReadConfig{}.Read(NewEnvBucket())
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if len(config.LogExport.Sinks) != 0 {
+		t.Fatalf("want no log export sinks, got: %v", config.LogExport.Sinks)
+	}
+}
+
+func TestRead_LogExportSinks(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_export_sinks", "stdout, loki")
+	defaults.Setenv("log_export_loki_url", "http://loki:3100/loki/api/v1/push")
+	defaults.Setenv("log_export_file_max_mb", "10")
+
+	config, err := ReadConfig{}.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if len(config.LogExport.Sinks) != 2 || config.LogExport.Sinks[1] != "loki" {
+		t.Fatalf("want stdout and loki sinks, got: %v", config.LogExport.Sinks)
+	}
+
+	if config.LogExport.FileMaxBytes != 10*1024*1024 {
+		t.Fatalf("want file max bytes of 10MB, got: %d", config.LogExport.FileMaxBytes)
+	}
+}
+
+func TestRead_LogExportInvalidOverflow(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_export_overflow", "wait")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for an invalid overflow policy")
+	}
+}
+
+func TestRead_LogExportInvalidFlushInterval(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_export_flush_interval", "0s")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for a flush interval of zero")
+	}
+}
+
+func TestRead_LogExportInvalidBufferSize(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_export_buffer_size", "0")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for a buffer size of zero")
+	}
+}
+
+func TestRead_LogExportInvalidBatchSize(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("log_export_batch_size", "-1")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for a negative batch size")
+	}
+}
+
+func TestRead_SecretBackend(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("secret_backend", "vault")
+	defaults.Setenv("secret_backend_vault_addr", "http://vault:8200")
+
+	config, err := ReadConfig{}.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.SecretBackend.Backend != "vault" || config.SecretBackend.VaultMount != "secret" {
+		t.Fatalf("want vault backend with the default mount, got: %+v", config.SecretBackend)
+	}
+
+	defaults.Setenv("secret_backend", "s3")
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for an unknown secret backend")
+	}
+}
+
+func TestRead_SecretBackendInvalidSyncInterval(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("secret_backend", "file")
+	defaults.Setenv("secret_backend_sync_interval", "0s")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error for a sync interval of zero")
+	}
+}
+
+func TestRead_SecretEncryption(t *testing.T) {
+	defaults := NewEnvBucket()
+	defaults.Setenv("secret_encryption_kek", "file")
+
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error when no decrypt image is set")
+	}
+
+	defaults.Setenv("secret_encryption_decrypt_image", "ghcr.io/openfaas/faas-netes:latest")
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error when no host path is set for the file KEK")
+	}
+
+	defaults.Setenv("secret_encryption_kek_host_path", "/etc/openfaas/kek")
+	config, err := ReadConfig{}.Read(defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.SecretEncryption.KEKFile != "/var/openfaas/kek/kek" {
+		t.Fatalf("want default KEK file, got: %q", config.SecretEncryption.KEKFile)
+	}
+
+	defaults.Setenv("secret_backend", "vault")
+	if _, err := (ReadConfig{}).Read(defaults); err == nil {
+		t.Fatal("want error when combined with a secret backend")
+	}
+}
+
+func TestRead_DeploymentDefaults(t *testing.T) {
+	config, err := ReadConfig{}.Read(NewEnvBucket())
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.RuntimeHTTPPort != 8080 {
+		t.Errorf("RuntimeHTTPPort want: 8080, got: %d", config.RuntimeHTTPPort)
+	}
+	if config.ImagePullPolicy != "Always" {
+		t.Errorf("ImagePullPolicy want: Always, got: %s", config.ImagePullPolicy)
+	}
+	if config.RevisionHistoryLimit != 10 {
+		t.Errorf("RevisionHistoryLimit want: 10, got: %d", config.RevisionHistoryLimit)
+	}
+
+	want := ProbeConfig{InitialDelaySeconds: 2, TimeoutSeconds: 1, PeriodSeconds: 2, SuccessThreshold: 1, FailureThreshold: 3}
+	if config.ReadinessProbe != want {
+		t.Errorf("ReadinessProbe want: %+v, got: %+v", want, config.ReadinessProbe)
+	}
+	if config.LivenessProbe != want {
+		t.Errorf("LivenessProbe want: %+v, got: %+v", want, config.LivenessProbe)
+	}
+}
+
+func TestRead_DeploymentDefaultsFromEnv(t *testing.T) {
+	env := NewEnvBucket()
+	env.Setenv("runtime_http_port", "8000")
+	env.Setenv("image_pull_policy", "IfNotPresent")
+	env.Setenv("revision_history_limit", "2")
+	env.Setenv("readiness_probe_initial_delay_seconds", "0")
+	env.Setenv("readiness_probe_failure_threshold", "6")
+	env.Setenv("liveness_probe_period_seconds", "10")
+	env.Setenv("default_requests_memory", "64Mi")
+	env.Setenv("default_limits_memory", "128Mi")
+
+	config, err := ReadConfig{}.Read(env)
+	if err != nil {
+		t.Fatalf("Unexpected error while reading env %s", err.Error())
+	}
+
+	if config.RuntimeHTTPPort != 8000 {
+		t.Errorf("RuntimeHTTPPort want: 8000, got: %d", config.RuntimeHTTPPort)
+	}
+	if config.ImagePullPolicy != "IfNotPresent" {
+		t.Errorf("ImagePullPolicy want: IfNotPresent, got: %s", config.ImagePullPolicy)
+	}
+	if config.RevisionHistoryLimit != 2 {
+		t.Errorf("RevisionHistoryLimit want: 2, got: %d", config.RevisionHistoryLimit)
+	}
+	if config.ReadinessProbe.InitialDelaySeconds != 0 || config.ReadinessProbe.FailureThreshold != 6 {
+		t.Errorf("ReadinessProbe want initial delay 0 and failure threshold 6, got: %+v", config.ReadinessProbe)
+	}
+	if config.LivenessProbe.PeriodSeconds != 10 {
+		t.Errorf("LivenessProbe want period 10, got: %+v", config.LivenessProbe)
+	}
+	if config.DefaultRequests.Memory != "64Mi" || config.DefaultLimits.Memory != "128Mi" {
+		t.Errorf("want default memory 64Mi/128Mi, got: %s/%s", config.DefaultRequests.Memory, config.DefaultLimits.Memory)
+	}
+}
+
+func TestRead_DeploymentDefaultsInvalid(t *testing.T) {
+	cases := map[string]map[string]string{
+		"port out of range":         {"runtime_http_port": "0"},
+		"unknown pull policy":       {"image_pull_policy": "Sometimes"},
+		"negative revision history": {"revision_history_limit": "-1"},
+		"non-numeric probe period":  {"readiness_probe_period_seconds": "2s"},
+		"zero probe timeout":        {"liveness_probe_timeout_seconds": "0"},
+		"liveness success > 1":      {"liveness_probe_success_threshold": "2"},
+		"invalid quantity":          {"default_requests_cpu": "lots"},
+		"request above limit":       {"default_requests_memory": "1Gi", "default_limits_memory": "128Mi"},
+	}
+
+	for name, vars := range cases {
+		t.Run(name, func(t *testing.T) {
+			env := NewEnvBucket()
+			for k, v := range vars {
+				env.Setenv(k, v)
+			}
+
+			if _, err := (ReadConfig{}).Read(env); err == nil {
+				t.Fatalf("want error for %v", vars)
+			}
+		})
+	}
+}
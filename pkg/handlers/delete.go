@@ -11,8 +11,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	"github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -130,5 +132,10 @@ func deleteFunction(functionNamespace string, clientset *kubernetes.Clientset, r
 		w.Write([]byte(svcErr.Error()))
 		return fmt.Errorf("error deleting function's service")
 	}
+
+	if err := k8s.DeleteFunctionServiceAccounts(context.TODO(), clientset, functionNamespace, request.FunctionName); err != nil {
+		log.Printf("error deleting ServiceAccounts of %s.%s: %s\n", request.FunctionName, functionNamespace, err)
+	}
+
 	return nil
 }
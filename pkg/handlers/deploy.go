@@ -9,6 +9,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,11 +18,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/openfaas/faas-netes/pkg/imageverify"
 	"github.com/openfaas/faas-netes/pkg/k8s"
 
 	types "github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -50,7 +53,7 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory, fu
 			return
 		}
 
-		if err := ValidateDeployRequest(&request); err != nil {
+		if err := ValidateDeployRequest(&request, factory.Config.MaxFunctionTimeout); err != nil {
 			wrappedErr := fmt.Errorf("validation failed: %s", err.Error())
 			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
 			return
@@ -78,6 +81,20 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory, fu
 			return
 		}
 
+		keychain := factory.RegistryKeychain(r.Context(), namespace, request)
+		if err := factory.PinImageDigest(r.Context(), &request, keychain); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), registryErrorStatus(err))
+			return
+		}
+
+		if err := factory.VerifyImage(r.Context(), &request, keychain); err != nil {
+			wrappedErr := fmt.Errorf("image verification failed: %s", err.Error())
+			log.Println(wrappedErr)
+			http.Error(w, wrappedErr.Error(), registryErrorStatus(err))
+			return
+		}
+
 		deploymentSpec, specErr := makeDeploymentSpec(request, existingSecrets, factory)
 		if specErr != nil {
 			wrappedErr := fmt.Errorf("failed create Deployment spec: %s", specErr.Error())
@@ -99,6 +116,13 @@ func MakeDeployHandler(functionNamespace string, factory k8s.FunctionFactory, fu
 			return
 		}
 
+		if err := factory.EnsureServiceAccount(r.Context(), namespace, request); err != nil {
+			wrappedErr := fmt.Errorf("unable to create ServiceAccount: %s", err.Error())
+			log.Println(wrappedErr)
+			http.Error(w, wrappedErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		deploy := factory.Client.AppsV1().Deployments(namespace)
 		if _, err = deploy.Create(context.TODO(), deploymentSpec, metav1.CreateOptions{}); err != nil {
 			wrappedErr := fmt.Errorf("unable create Deployment: %s", err.Error())
@@ -153,6 +177,7 @@ func makeDeploymentSpec(request types.FunctionDeployment, existingSecrets map[st
 	if err != nil {
 		return nil, err
 	}
+	factory.ConfigureDefaultResources(resources)
 
 	annotations, err := buildAnnotations(request)
 	if err != nil {
@@ -164,6 +189,11 @@ func makeDeploymentSpec(request types.FunctionDeployment, existingSecrets map[st
 		return nil, err
 	}
 
+	pullPolicy, err := factory.ImagePullPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+
 	deploymentSpec := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        request.Service,
@@ -192,7 +222,7 @@ func makeDeploymentSpec(request types.FunctionDeployment, existingSecrets map[st
 					},
 				},
 			},
-			RevisionHistoryLimit: int32p(10),
+			RevisionHistoryLimit: int32p(factory.Config.RevisionHistoryLimit),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:        request.Service,
@@ -214,9 +244,10 @@ func makeDeploymentSpec(request types.FunctionDeployment, existingSecrets map[st
 							},
 							Env:             envVars,
 							Resources:       *resources,
-							ImagePullPolicy: corev1.PullAlways,
+							ImagePullPolicy: pullPolicy,
 							LivenessProbe:   probes.Liveness,
 							ReadinessProbe:  probes.Readiness,
+							StartupProbe:    probes.Startup,
 							SecurityContext: &corev1.SecurityContext{
 								ReadOnlyRootFilesystem: &request.ReadOnlyRootFilesystem,
 							},
@@ -232,6 +263,10 @@ func makeDeploymentSpec(request types.FunctionDeployment, existingSecrets map[st
 	factory.ConfigureReadOnlyRootFilesystem(request, deploymentSpec)
 	factory.ConfigureContainerUserID(deploymentSpec)
 
+	if err := factory.ConfigureServiceAccount(request, deploymentSpec); err != nil {
+		return nil, err
+	}
+
 	if err := factory.ConfigureSecrets(request, deploymentSpec, existingSecrets); err != nil {
 		return nil, err
 	}
@@ -326,6 +361,15 @@ func buildEnvVars(request *types.FunctionDeployment) []corev1.EnvVar {
 	return envVars
 }
 
+// registryErrorStatus is a bad request when the image is invalid or could not be
+// verified, and a bad gateway when its registry could not be read
+func registryErrorStatus(err error) int {
+	if errors.Is(err, imageverify.ErrNotVerified) || k8serrors.IsBadRequest(err) {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
 func int32p(i int32) *int32 {
 	return &i
 }
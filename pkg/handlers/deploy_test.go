@@ -4,10 +4,15 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
+	"github.com/openfaas/faas-netes/pkg/imageverify"
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/kubernetes/fake"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -231,3 +236,23 @@ func Test_buildEnvVars_FourSortedKeys(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_registryErrorStatus(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not verified", fmt.Errorf("%w: no signature found", imageverify.ErrNotVerified), http.StatusBadRequest},
+		{"invalid image", k8serrors.NewBadRequest("unable to parse image reference"), http.StatusBadRequest},
+		{"registry unavailable", errors.New("unable to resolve digest: connection refused"), http.StatusBadGateway},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := registryErrorStatus(tc.err); got != tc.want {
+				t.Errorf("want status %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
@@ -97,7 +97,7 @@ func Test_ValidateDeployRequest_InvalidRequest(t *testing.T) {
 			Image:   testCase.imageName,
 		}
 
-		err := ValidateDeployRequest(&request)
+		err := ValidateDeployRequest(&request, 0)
 		if err == nil {
 			t.Fatalf("Expected error for scenario: %s", testCase.scenario)
 		}
@@ -113,7 +113,7 @@ func Test_ValidateDeploymentRequest_ValidRequest(t *testing.T) {
 		Image:   "test-image",
 	}
 
-	err := ValidateDeployRequest(&request)
+	err := ValidateDeployRequest(&request, 0)
 	if err != nil {
 		t.Errorf("unexpected ValidateDeploymentRequest error: %s", err.Error())
 	}
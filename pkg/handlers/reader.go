@@ -21,8 +21,20 @@ import (
 	"github.com/openfaas/faas-netes/pkg/k8s"
 )
 
+// InvocationCounter returns the number of invocations recorded for a function
+type InvocationCounter interface {
+	InvocationCount(name, namespace string) float64
+}
+
+// UsageReader returns the CPU and memory used by all replicas of a function
+type UsageReader interface {
+	Usage(name, namespace string) *types.FunctionUsage
+}
+
 // MakeFunctionReader handler for reading functions deployed in the cluster as deployments.
-func MakeFunctionReader(defaultNamespace string, deploymentLister v1.DeploymentLister) http.HandlerFunc {
+// The invocations counter and usage reader are optional, when set they populate the
+// InvocationCount and Usage of each function.
+func MakeFunctionReader(defaultNamespace string, deploymentLister v1.DeploymentLister, invocations InvocationCounter, usage UsageReader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		q := r.URL.Query()
@@ -44,7 +56,7 @@ func MakeFunctionReader(defaultNamespace string, deploymentLister v1.DeploymentL
 			return
 		}
 
-		functions, err := getServiceList(lookupNamespace, deploymentLister)
+		functions, err := getServiceList(lookupNamespace, deploymentLister, invocations, usage)
 		if err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -66,7 +78,7 @@ func MakeFunctionReader(defaultNamespace string, deploymentLister v1.DeploymentL
 	}
 }
 
-func getServiceList(functionNamespace string, deploymentLister v1.DeploymentLister) ([]types.FunctionStatus, error) {
+func getServiceList(functionNamespace string, deploymentLister v1.DeploymentLister, invocations InvocationCounter, usage UsageReader) ([]types.FunctionStatus, error) {
 	functions := []types.FunctionStatus{}
 
 	sel := labels.NewSelector()
@@ -86,6 +98,7 @@ func getServiceList(functionNamespace string, deploymentLister v1.DeploymentList
 		if item != nil {
 			function := k8s.AsFunctionStatus(*item)
 			if function != nil {
+				addFunctionStats(function, invocations, usage)
 				functions = append(functions, *function)
 			}
 		}
@@ -93,3 +106,14 @@ func getServiceList(functionNamespace string, deploymentLister v1.DeploymentList
 
 	return functions, nil
 }
+
+// addFunctionStats populates the fields of the status which are not read from the Deployment
+func addFunctionStats(function *types.FunctionStatus, invocations InvocationCounter, usage UsageReader) {
+	if invocations != nil {
+		function.InvocationCount = invocations.InvocationCount(function.Name, function.Namespace)
+	}
+
+	if usage != nil {
+		function.Usage = usage.Usage(function.Name, function.Namespace)
+	}
+}
@@ -0,0 +1,140 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// MakeRegistryCredentialsHandler makes a handler for Create/List/Delete/Update of
+// registry credentials, which are stored as kubernetes.io/dockerconfigjson secrets
+func MakeRegistryCredentialsHandler(defaultNamespace string, kube kubernetes.Interface, deploymentLister v1.DeploymentLister) http.HandlerFunc {
+	handler := RegistryCredentialsHandler{
+		LookupNamespace: NewNamespaceResolver(defaultNamespace, kube),
+		Credentials:     k8s.NewRegistryCredentialsClient(kube),
+		References:      k8s.NewFunctionSecretReferences(defaultNamespace, deploymentLister, kube),
+	}
+	return handler.ServeHTTP
+}
+
+// RegistryCredentialsHandler manages the credentials used to pull function images
+type RegistryCredentialsHandler struct {
+	Credentials     k8s.RegistryCredentialsClient
+	LookupNamespace NamespaceResolver
+	References      SecretReferences
+}
+
+func (h RegistryCredentialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+
+	namespace, err := h.LookupNamespace(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(namespace, w)
+	case http.MethodPost, http.MethodPut:
+		h.write(namespace, w, r)
+	case http.MethodDelete:
+		h.delete(namespace, w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h RegistryCredentialsHandler) list(namespace string, w http.ResponseWriter) {
+	res, err := h.Credentials.List(namespace)
+	if err != nil {
+		status, reason := ProcessErrorReasons(err)
+		log.Printf("Registry credentials list error reason: %s, %v\n", reason, err)
+		w.WriteHeader(status)
+		return
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("Registry credentials json marshal error: %v\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (h RegistryCredentialsHandler) write(namespace string, w http.ResponseWriter, r *http.Request) {
+	credential := k8s.RegistryCredential{}
+	if err := json.NewDecoder(r.Body).Decode(&credential); err != nil {
+		log.Printf("Registry credentials unmarshal error: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	credential.Namespace = namespace
+
+	var err error
+	if r.Method == http.MethodPost {
+		err = h.Credentials.Create(credential)
+	} else {
+		err = h.Credentials.Replace(credential)
+	}
+
+	if err != nil {
+		status, reason := ProcessErrorReasons(err)
+		log.Printf("Registry credentials %s error reason: %s, %v\n", strings.ToLower(r.Method), reason, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h RegistryCredentialsHandler) delete(namespace string, w http.ResponseWriter, r *http.Request) {
+	credential := k8s.RegistryCredential{}
+	if err := json.NewDecoder(r.Body).Decode(&credential); err != nil {
+		log.Printf("Registry credentials unmarshal error: %v\n", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// functions which use the credentials would fail to pull their image on a new node
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if !force && h.References != nil {
+		references, err := h.References.References(namespace)
+		if err != nil {
+			log.Printf("Registry credentials references error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if functions := references[credential.Name]; len(functions) > 0 {
+			msg := fmt.Sprintf("registry credentials %s are used by functions: %s, set force=true to delete them anyway", credential.Name, strings.Join(functions, ", "))
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+
+	if err := h.Credentials.Delete(namespace, credential.Name); err != nil {
+		status, reason := ProcessErrorReasons(err)
+		log.Printf("Registry credentials delete error reason: %s, %v\n", reason, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,70 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_RegistryCredentialsHandler(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	handler := MakeRegistryCredentialsHandler(namespace, kube, newDeploymentLister(newSecretFunction(namespace, "figlet", "ghcr")))
+
+	body := `{"name": "ghcr", "server": "ghcr.io", "username": "alex", "password": "s3cr3t"}`
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/system/registry-credentials", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/system/registry-credentials", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"registries":["ghcr.io"]`) {
+		t.Fatalf("want ghcr.io in the registries, got: %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "s3cr3t") || strings.Contains(w.Body.String(), "alex") {
+		t.Fatalf("want credentials to be hidden, got: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "http://example.com/system/registry-credentials", strings.NewReader(`{"name": "ghcr"}`))
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("want status code '%d' for credentials in use, got '%d'", http.StatusConflict, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "http://example.com/system/registry-credentials?force=true", strings.NewReader(`{"name": "ghcr"}`))
+	w = httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d' when forced, got '%d': %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+}
+
+func Test_RegistryCredentialsHandler_InvalidRequest(t *testing.T) {
+	handler := MakeRegistryCredentialsHandler("of-fnc", testclient.NewSimpleClientset(), newDeploymentLister())
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/system/registry-credentials", strings.NewReader(`{"name": "hub", "username": "alex"}`))
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusBadRequest, w.Code)
+	}
+}
@@ -29,7 +29,7 @@ const MaxReplicas = 5
 const MaxFunctions = 15
 
 // MakeReplicaReader reads the amount of replicas for a deployment
-func MakeReplicaReader(defaultNamespace string, lister v1.DeploymentLister) http.HandlerFunc {
+func MakeReplicaReader(defaultNamespace string, lister v1.DeploymentLister, invocations InvocationCounter, usage UsageReader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		vars := mux.Vars(r)
@@ -49,7 +49,7 @@ func MakeReplicaReader(defaultNamespace string, lister v1.DeploymentLister) http
 			return
 		}
 
-		function, err := getService(lookupNamespace, functionName, lister)
+		function, err := getService(lookupNamespace, functionName, lister, invocations, usage)
 		if err != nil {
 			log.Printf("Unable to fetch service: %s", functionName)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -76,7 +76,7 @@ func MakeReplicaReader(defaultNamespace string, lister v1.DeploymentLister) http
 }
 
 // getService returns a function/service or nil if not found
-func getService(functionNamespace string, functionName string, lister v1.DeploymentLister) (*types.FunctionStatus, error) {
+func getService(functionNamespace string, functionName string, lister v1.DeploymentLister, invocations InvocationCounter, usage UsageReader) (*types.FunctionStatus, error) {
 
 	item, err := lister.Deployments(functionNamespace).
 		Get(functionName)
@@ -92,6 +92,7 @@ func getService(functionNamespace string, functionName string, lister v1.Deploym
 	if item != nil {
 		function := k8s.AsFunctionStatus(*item)
 		if function != nil {
+			addFunctionStats(function, invocations, usage)
 			return function, nil
 		}
 	}
@@ -5,28 +5,39 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
 	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
 )
 
 // MakeSecretHandler makes a handler for Create/List/Delete/Update of
-// secrets in the Kubernetes API
-func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface) http.HandlerFunc {
+// secrets via the SecretsClient
+func MakeSecretHandler(defaultNamespace string, kube kubernetes.Interface, secrets k8s.SecretsClient, deploymentLister v1.DeploymentLister) http.HandlerFunc {
 	handler := SecretsHandler{
 		LookupNamespace: NewNamespaceResolver(defaultNamespace, kube),
-		Secrets:         k8s.NewSecretsClient(kube),
+		Secrets:         secrets,
+		References:      k8s.NewFunctionSecretReferences(defaultNamespace, deploymentLister, kube),
 	}
 	return handler.ServeHTTP
 }
 
+// SecretReferences finds the functions which reference each secret in a namespace
+type SecretReferences interface {
+	References(namespace string) (map[string][]string, error)
+}
+
 // SecretsHandler enabling to create openfaas secrets across namespaces
 type SecretsHandler struct {
 	Secrets         k8s.SecretsClient
 	LookupNamespace NamespaceResolver
+	References      SecretReferences
 }
 
 func (h SecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -71,14 +82,22 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 		return
 	}
 
-	secrets := make([]types.Secret, len(res))
-	for idx, name := range res {
-		secrets[idx] = types.Secret{
-			Name:      name,
-			Namespace: namespace,
+	if h.References != nil {
+		references, err := h.References.References(namespace)
+		if err != nil {
+			log.Printf("Secret references error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for idx := range res {
+			if functions, ok := references[res[idx].Name]; ok {
+				res[idx].Functions = functions
+			}
 		}
 	}
-	secretsBytes, err := json.Marshal(secrets)
+
+	secretsBytes, err := json.Marshal(res)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("Secrets json marshal error: %v\n", err)
@@ -90,7 +109,7 @@ func (h SecretsHandler) listSecrets(namespace string, w http.ResponseWriter, r *
 }
 
 func (h SecretsHandler) createSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
+	secret := k8s.Secret{}
 	err := json.NewDecoder(r.Body).Decode(&secret)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -111,7 +130,7 @@ func (h SecretsHandler) createSecret(namespace string, w http.ResponseWriter, r
 }
 
 func (h SecretsHandler) replaceSecret(namespace string, w http.ResponseWriter, r *http.Request) {
-	secret := types.Secret{}
+	secret := k8s.Secret{}
 	err := json.NewDecoder(r.Body).Decode(&secret)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -140,6 +159,24 @@ func (h SecretsHandler) deleteSecret(namespace string, w http.ResponseWriter, r
 		return
 	}
 
+	// deleting a secret which is in use would stop new replicas of the function from
+	// starting, so it must be forced
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if !force && h.References != nil {
+		references, err := h.References.References(namespace)
+		if err != nil {
+			log.Printf("Secret references error: %v\n", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if functions := references[secret.Name]; len(functions) > 0 {
+			msg := fmt.Sprintf("secret %s is used by functions: %s, set force=true to delete it anyway", secret.Name, strings.Join(functions, ", "))
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+	}
+
 	err = h.Secrets.Delete(namespace, secret.Name)
 	if err != nil {
 		status, reason := ProcessErrorReasons(err)
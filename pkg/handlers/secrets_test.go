@@ -14,18 +14,32 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 const secretLabel = "app.kubernetes.io/managed-by"
 const secretLabelValue = "openfaas"
 
+// newDeploymentLister returns a lister for the given function Deployments
+func newDeploymentLister(deployments ...*appsv1.Deployment) appslisters.DeploymentLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, d := range deployments {
+		indexer.Add(d)
+	}
+	return appslisters.NewDeploymentLister(indexer)
+}
+
 func Test_SecretsHandler(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), newDeploymentLister()).ServeHTTP
 	secretName := "testsecret"
 
 	t.Run("create managed secrets", func(t *testing.T) {
@@ -273,7 +287,7 @@ func Test_SecretsHandler(t *testing.T) {
 func Test_SecretsHandler_ListEmpty(t *testing.T) {
 	namespace := "of-fnc"
 	kube := testclient.NewSimpleClientset()
-	secretsHandler := MakeSecretHandler(namespace, kube).ServeHTTP
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), newDeploymentLister()).ServeHTTP
 
 	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
 	w := httptest.NewRecorder()
@@ -290,3 +304,165 @@ func Test_SecretsHandler_ListEmpty(t *testing.T) {
 		t.Errorf(`want empty list to be valid json i.e. "[]", but was %q`, string(body))
 	}
 }
+
+func Test_SecretsHandler_CreateMultipleKeys(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), newDeploymentLister()).ServeHTTP
+
+	// "a2V5" is "key" encoded as base64
+	payload := `{"name": "tls", "data": {"tls.crt": "cert"}, "rawData": {"tls.key": "a2V5"}}`
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(payload))
+	w := httptest.NewRecorder()
+
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusAccepted, w.Code)
+	}
+
+	actualSecret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error validating secret: %s", err)
+	}
+
+	if len(actualSecret.Data) != 2 {
+		t.Fatalf("want 2 keys, got: %d", len(actualSecret.Data))
+	}
+
+	if string(actualSecret.Data["tls.crt"]) != "cert" || string(actualSecret.Data["tls.key"]) != "key" {
+		t.Fatalf("want values for tls.crt and tls.key, got: %v", actualSecret.Data)
+	}
+}
+
+func Test_SecretsHandler_CreateInvalidKeys(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset()
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), newDeploymentLister()).ServeHTTP
+
+	payloads := []string{
+		`{"name": "config", "data": {"../etc/passwd": "root"}}`,
+		`{"name": "config", "data": {"a": "1"}, "rawData": {"a": "MQ=="}}`,
+		`{"name": "config", "value": "1", "data": {"a": "1"}}`,
+	}
+
+	for _, payload := range payloads {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/foo", strings.NewReader(payload))
+		w := httptest.NewRecorder()
+
+		secretsHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("payload: %s, want status code '%d', got '%d'", payload, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func Test_SecretsHandler_ListMetadata(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "tls",
+			Namespace: namespace,
+			Labels:    map[string]string{secretLabel: secretLabelValue},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{"tls.key": []byte("key"), "tls.crt": []byte("cert")},
+	})
+
+	function := newSecretFunction(namespace, "figlet", "tls")
+
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), newDeploymentLister(function)).ServeHTTP
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	w := httptest.NewRecorder()
+
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusOK, w.Code)
+	}
+
+	if strings.Contains(w.Body.String(), "cert") {
+		t.Fatalf("want no secret values in the list, got: %s", w.Body.String())
+	}
+
+	secrets := []k8s.SecretMetadata{}
+	if err := json.Unmarshal(w.Body.Bytes(), &secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secrets) != 1 {
+		t.Fatalf("want 1 secret, got: %d", len(secrets))
+	}
+
+	got := secrets[0]
+	if got.Type != "Opaque" || strings.Join(got.Keys, ",") != "tls.crt,tls.key" {
+		t.Errorf("want Opaque secret with tls.crt and tls.key, got: %s %v", got.Type, got.Keys)
+	}
+
+	if strings.Join(got.Functions, ",") != "figlet" {
+		t.Errorf("want secret to be referenced by figlet, got: %v", got.Functions)
+	}
+}
+
+// newSecretFunction returns a function Deployment which mounts the secret
+func newSecretFunction(namespace, name, secret string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"faas_function": name},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{
+						Name: name + "-projected-secrets",
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{{
+									Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: secret}},
+								}},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func Test_SecretsHandler_DeleteInUse(t *testing.T) {
+	namespace := "of-fnc"
+	kube := testclient.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: namespace},
+	})
+
+	lister := newDeploymentLister(newSecretFunction(namespace, "figlet", "api-key"), newSecretFunction(namespace, "env", "api-key"))
+	secretsHandler := MakeSecretHandler(namespace, kube, k8s.NewSecretsClient(kube), lister).ServeHTTP
+
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/foo", strings.NewReader(`{"name": "api-key"}`))
+	w := httptest.NewRecorder()
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("want status code '%d', got '%d'", http.StatusConflict, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "env, figlet") {
+		t.Fatalf("want dependent functions in the response, got: %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "http://example.com/foo?force=true", strings.NewReader(`{"name": "api-key"}`))
+	w = httptest.NewRecorder()
+	secretsHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("want status code '%d' when forced, got '%d'", http.StatusAccepted, w.Code)
+	}
+
+	if _, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "api-key", metav1.GetOptions{}); err == nil {
+		t.Fatal("want secret to be deleted")
+	}
+}
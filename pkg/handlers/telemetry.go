@@ -0,0 +1,140 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InvocationStats returns the invocations and errors recorded for a function
+type InvocationStats interface {
+	InvocationCounter
+	ErrorCount(name, namespace string) float64
+}
+
+// APILatencyReader summarises the latency of requests to the Kubernetes API
+type APILatencyReader interface {
+	Summary() metrics.APILatencySummary
+}
+
+// Telemetry is a snapshot of the provider returned by /system/telemetry
+type Telemetry struct {
+	// Functions is the number of functions deployed
+	Functions int `json:"functions"`
+
+	// Invocations is the total number of invocations across all functions
+	Invocations float64 `json:"invocations"`
+
+	// Errors is the total number of invocations which resulted in a 5xx status code
+	Errors float64 `json:"errors"`
+
+	// FunctionStats contains the replicas and invocations per function
+	FunctionStats []FunctionTelemetry `json:"functionStats"`
+
+	// Informers reports whether each informer cache has synced
+	Informers map[string]bool `json:"informers"`
+
+	// KubernetesAPI summarises the latency of requests to the Kubernetes API
+	KubernetesAPI metrics.APILatencySummary `json:"kubernetesApi"`
+}
+
+// FunctionTelemetry contains the replicas and invocations of a function
+type FunctionTelemetry struct {
+	Name              string  `json:"name"`
+	Namespace         string  `json:"namespace"`
+	Replicas          uint64  `json:"replicas"`
+	AvailableReplicas uint64  `json:"availableReplicas"`
+	Invocations       float64 `json:"invocations"`
+	Errors            float64 `json:"errors"`
+}
+
+// MakeTelemetryHandler creates a handler for /system/telemetry which returns a JSON snapshot
+// of the provider for dashboards which can't scrape Prometheus. The informers map is keyed
+// by the name of each informer.
+func MakeTelemetryHandler(defaultNamespace string, lister v1.DeploymentLister, invocations InvocationStats, informers map[string]cache.InformerSynced, apiLatency APILatencyReader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		telemetry, err := getTelemetry(defaultNamespace, lister, invocations, informers, apiLatency)
+		if err != nil {
+			log.Printf("Unable to gather telemetry: %s", err)
+			http.Error(w, "Unable to gather telemetry", http.StatusInternalServerError)
+			return
+		}
+
+		out, err := json.Marshal(telemetry)
+		if err != nil {
+			log.Printf("Failed to marshal telemetry: %s", err)
+			http.Error(w, "Failed to marshal telemetry", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+	}
+}
+
+func getTelemetry(namespace string, lister v1.DeploymentLister, invocations InvocationStats, informers map[string]cache.InformerSynced, apiLatency APILatencyReader) (*Telemetry, error) {
+	req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := lister.Deployments(namespace).List(labels.NewSelector().Add(*req))
+	if err != nil {
+		return nil, err
+	}
+
+	telemetry := Telemetry{
+		Functions:     len(deployments),
+		FunctionStats: []FunctionTelemetry{},
+		Informers:     map[string]bool{},
+	}
+
+	for _, item := range deployments {
+		stats := FunctionTelemetry{
+			Name:              item.Name,
+			Namespace:         item.Namespace,
+			AvailableReplicas: uint64(item.Status.AvailableReplicas),
+		}
+		if item.Spec.Replicas != nil {
+			stats.Replicas = uint64(*item.Spec.Replicas)
+		}
+
+		if invocations != nil {
+			stats.Invocations = invocations.InvocationCount(item.Name, item.Namespace)
+			stats.Errors = invocations.ErrorCount(item.Name, item.Namespace)
+		}
+
+		telemetry.Invocations += stats.Invocations
+		telemetry.Errors += stats.Errors
+		telemetry.FunctionStats = append(telemetry.FunctionStats, stats)
+	}
+
+	sort.Slice(telemetry.FunctionStats, func(i, j int) bool {
+		return telemetry.FunctionStats[i].Name < telemetry.FunctionStats[j].Name
+	})
+
+	for name, hasSynced := range informers {
+		telemetry.Informers[name] = hasSynced()
+	}
+
+	if apiLatency != nil {
+		telemetry.KubernetesAPI = apiLatency.Summary()
+	}
+
+	return &telemetry, nil
+}
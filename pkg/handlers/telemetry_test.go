@@ -0,0 +1,104 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openfaas/faas-netes/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type fakeInvocationStats map[string][2]float64
+
+func (f fakeInvocationStats) InvocationCount(name, namespace string) float64 {
+	return f[name][0]
+}
+
+func (f fakeInvocationStats) ErrorCount(name, namespace string) float64 {
+	return f[name][1]
+}
+
+type fakeAPILatency struct{}
+
+func (fakeAPILatency) Summary() metrics.APILatencySummary {
+	return metrics.APILatencySummary{Requests: 10, AverageSeconds: 0.5, MaxSeconds: 1}
+}
+
+func Test_MakeTelemetryHandler(t *testing.T) {
+	namespace := "openfaas-fn"
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	for _, name := range []string{"figlet", "env"} {
+		replicas := int32(2)
+		indexer.Add(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{"faas_function": name},
+			},
+			Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{AvailableReplicas: 1},
+		})
+	}
+
+	// not a function, so it should not be reported
+	indexer.Add(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: namespace},
+	})
+
+	invocations := fakeInvocationStats{
+		"figlet": {10, 2},
+		"env":    {5, 0},
+	}
+	informers := map[string]cache.InformerSynced{
+		"deployments": func() bool { return true },
+		"endpoints":   func() bool { return false },
+	}
+
+	handler := MakeTelemetryHandler(namespace, appslisters.NewDeploymentLister(indexer), invocations, informers, fakeAPILatency{})
+
+	req := httptest.NewRequest(http.MethodGet, "/system/telemetry", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	got := Telemetry{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Functions != 2 {
+		t.Errorf("want 2 functions, got: %d", got.Functions)
+	}
+
+	if got.Invocations != 15 || got.Errors != 2 {
+		t.Errorf("want 15 invocations and 2 errors, got: %f and %f", got.Invocations, got.Errors)
+	}
+
+	if len(got.FunctionStats) != 2 || got.FunctionStats[0].Name != "env" {
+		t.Fatalf("want function stats sorted by name, got: %v", got.FunctionStats)
+	}
+
+	if got.FunctionStats[1].Replicas != 2 || got.FunctionStats[1].AvailableReplicas != 1 {
+		t.Errorf("want 2 replicas with 1 available, got: %v", got.FunctionStats[1])
+	}
+
+	if !got.Informers["deployments"] || got.Informers["endpoints"] {
+		t.Errorf("want informer sync state to be reported, got: %v", got.Informers)
+	}
+
+	if got.KubernetesAPI.Requests != 10 {
+		t.Errorf("want 10 API requests, got: %d", got.KubernetesAPI.Requests)
+	}
+}
@@ -14,7 +14,6 @@ import (
 
 	"github.com/openfaas/faas-netes/pkg/k8s"
 	types "github.com/openfaas/faas-provider/types"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,7 +35,7 @@ func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) htt
 			return
 		}
 
-		if err := ValidateDeployRequest(&request); err != nil {
+		if err := ValidateDeployRequest(&request, factory.Config.MaxFunctionTimeout); err != nil {
 			wrappedErr := fmt.Errorf("validation failed: %s", err.Error())
 			http.Error(w, wrappedErr.Error(), http.StatusBadRequest)
 			return
@@ -57,6 +56,25 @@ func MakeUpdateHandler(defaultNamespace string, factory k8s.FunctionFactory) htt
 			return
 		}
 
+		if err := isAnonymous(request.Image); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		keychain := factory.RegistryKeychain(ctx, lookupNamespace, request)
+		if err := factory.PinImageDigest(ctx, &request, keychain); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), registryErrorStatus(err))
+			return
+		}
+
+		if err := factory.VerifyImage(ctx, &request, keychain); err != nil {
+			wrappedErr := fmt.Errorf("image verification failed: %s", err.Error())
+			log.Println(wrappedErr)
+			http.Error(w, wrappedErr.Error(), registryErrorStatus(err))
+			return
+		}
+
 		annotations, err := buildAnnotations(request)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -106,19 +124,26 @@ func updateDeploymentSpec(
 		return http.StatusNotFound, findDeployErr
 	}
 
-	if err := isAnonymous(request.Image); err != nil {
-		return http.StatusBadRequest, err
-	}
+	deployment.Spec.RevisionHistoryLimit = int32p(factory.Config.RevisionHistoryLimit)
 
 	if len(deployment.Spec.Template.Spec.Containers) > 0 {
 		deployment.Spec.Template.Spec.Containers[0].Image = request.Image
 
-		deployment.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullAlways
+		pullPolicy, err := factory.ImagePullPolicy(request)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		deployment.Spec.Template.Spec.Containers[0].ImagePullPolicy = pullPolicy
 
 		deployment.Spec.Template.Spec.Containers[0].Env = buildEnvVars(&request)
 
 		factory.ConfigureReadOnlyRootFilesystem(request, deployment)
 		factory.ConfigureContainerUserID(deployment)
+
+		if err := factory.ConfigureServiceAccount(request, deployment); err != nil {
+			return http.StatusBadRequest, err
+		}
+
 		deployment.Spec.Template.Spec.NodeSelector = map[string]string{}
 
 		labels := map[string]string{
@@ -147,13 +172,14 @@ func updateDeploymentSpec(
 		if resourceErr != nil {
 			return http.StatusBadRequest, resourceErr
 		}
+		factory.ConfigureDefaultResources(resources)
 
 		deployment.Spec.Template.Spec.Containers[0].Resources = *resources
 
 		secrets := k8s.NewSecretsClient(factory.Client)
 		existingSecrets, err := secrets.GetSecrets(functionNamespace, request.Secrets)
 		if err != nil {
-			return http.StatusBadRequest, err
+			return http.StatusBadRequest, fmt.Errorf("unable to fetch secrets: %s", err.Error())
 		}
 
 		err = factory.ConfigureSecrets(request, deployment, existingSecrets)
@@ -169,7 +195,13 @@ func updateDeploymentSpec(
 
 		deployment.Spec.Template.Spec.Containers[0].LivenessProbe = probes.Liveness
 		deployment.Spec.Template.Spec.Containers[0].ReadinessProbe = probes.Readiness
+		deployment.Spec.Template.Spec.Containers[0].StartupProbe = probes.Startup
+
+	}
 
+	// the ServiceAccount is only created once the spec is known to be valid
+	if err := factory.EnsureServiceAccount(ctx, functionNamespace, request); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to create ServiceAccount: %s", err.Error())
 	}
 
 	if _, updateErr := factory.Client.AppsV1().
@@ -11,10 +11,13 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"github.com/openfaas/faas-netes/pkg/proxy"
 	types "github.com/openfaas/faas-provider/types"
 )
 
@@ -34,7 +37,9 @@ func validateService(service string) error {
 }
 
 // ValidateDeployRequest validates that the service name is valid for Kubernetes
-func ValidateDeployRequest(request *types.FunctionDeployment) error {
+// and that any timeout requested for the function does not exceed maxTimeout,
+// a maxTimeout of zero disables the check.
+func ValidateDeployRequest(request *types.FunctionDeployment, maxTimeout time.Duration) error {
 
 	if request.Service == "" {
 		return fmt.Errorf("service: is required")
@@ -53,6 +58,91 @@ func ValidateDeployRequest(request *types.FunctionDeployment) error {
 		return err
 	}
 
+	if err := validateRetryAnnotations(request); err != nil {
+		return err
+	}
+
+	if err := validateTimeoutAnnotation(request, maxTimeout); err != nil {
+		return err
+	}
+
+	if err := validateSecretEnvAnnotation(request); err != nil {
+		return err
+	}
+
+	if _, err := k8s.ReadServiceAccountSpec(*request); err != nil {
+		return err
+	}
+
+	if _, err := k8s.ReadProbeSpec(*request); err != nil {
+		return err
+	}
+
+	if _, err := k8s.ReadImagePullPolicy(*request); err != nil {
+		return err
+	}
+
+	if _, err := k8s.ReadResolveDigest(*request, false); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateSecretEnvAnnotation checks that each secret exposed as an environment variable
+// is also one of the function's secrets
+func validateSecretEnvAnnotation(request *types.FunctionDeployment) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	envVars, err := k8s.ReadSecretEnvVars(*request.Annotations)
+	if err != nil {
+		return err
+	}
+
+	for _, envVar := range envVars {
+		found := false
+		for _, secret := range request.Secrets {
+			if secret == envVar.Secret {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%s: secret %s must also be listed in secrets", k8s.SecretsEnvAnnotation, envVar.Secret)
+		}
+	}
+
+	return nil
+}
+
+// validateRetryAnnotations checks that the retry policy given for the proxy can be parsed
+func validateRetryAnnotations(request *types.FunctionDeployment) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	_, err := proxy.ReadRetryPolicy(*request.Annotations)
+	return err
+}
+
+// validateTimeoutAnnotation checks that the function's timeout can be parsed and
+// is within the write timeout of the provider
+func validateTimeoutAnnotation(request *types.FunctionDeployment, maxTimeout time.Duration) error {
+	if request.Annotations == nil {
+		return nil
+	}
+
+	timeout, err := proxy.ReadTimeout(*request.Annotations)
+	if err != nil {
+		return err
+	}
+
+	if maxTimeout > 0 && timeout > maxTimeout {
+		return fmt.Errorf("%s: %s exceeds the provider's write_timeout of %s", proxy.TimeoutAnnotation, timeout, maxTimeout)
+	}
+
 	return nil
 }
 
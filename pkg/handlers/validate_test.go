@@ -6,6 +6,7 @@ package handlers
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/openfaas/faas-provider/types"
 )
@@ -109,3 +110,102 @@ func Test_validateScalingLabels(t *testing.T) {
 	}
 
 }
+
+func Test_validateTimeoutAnnotation(t *testing.T) {
+	maxTimeout := time.Minute
+
+	testCases := []struct {
+		Name        string
+		Annotations map[string]string
+		Err         error
+	}{
+		{
+			Name:        "no timeout",
+			Annotations: map[string]string{},
+		},
+		{
+			Name: "timeout within write_timeout",
+			Annotations: map[string]string{
+				"com.openfaas.timeout": "30s",
+			},
+		},
+		{
+			Name: "timeout exceeds write_timeout",
+			Annotations: map[string]string{
+				"com.openfaas.timeout": "2m",
+			},
+			Err: fmt.Errorf("com.openfaas.timeout: 2m0s exceeds the provider's write_timeout of 1m0s"),
+		},
+		{
+			Name: "invalid timeout",
+			Annotations: map[string]string{
+				"com.openfaas.timeout": "soon",
+			},
+			Err: fmt.Errorf("com.openfaas.timeout: \"soon\" is not a valid duration"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			gotErr := validateTimeoutAnnotation(&types.FunctionDeployment{Annotations: &tc.Annotations}, maxTimeout)
+			got := fmt.Errorf("")
+			if gotErr != nil {
+				got = gotErr
+			}
+			want := fmt.Errorf("")
+			if tc.Err != nil {
+				want = tc.Err
+			}
+
+			if got.Error() != want.Error() {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_validateSecretEnvAnnotation(t *testing.T) {
+	testCases := []struct {
+		Name        string
+		Annotations map[string]string
+		Secrets     []string
+		WantErr     bool
+	}{
+		{
+			Name:        "no annotation",
+			Annotations: map[string]string{},
+		},
+		{
+			Name:        "secret is listed",
+			Annotations: map[string]string{"com.openfaas.secrets.env": "api-key=API_KEY, tls/tls.key=TLS_KEY"},
+			Secrets:     []string{"api-key", "tls"},
+		},
+		{
+			Name:        "secret is not listed",
+			Annotations: map[string]string{"com.openfaas.secrets.env": "api-key=API_KEY"},
+			Secrets:     []string{"tls"},
+			WantErr:     true,
+		},
+		{
+			Name:        "invalid environment variable",
+			Annotations: map[string]string{"com.openfaas.secrets.env": "api-key=1API"},
+			Secrets:     []string{"api-key"},
+			WantErr:     true,
+		},
+		{
+			Name:        "missing environment variable",
+			Annotations: map[string]string{"com.openfaas.secrets.env": "api-key"},
+			Secrets:     []string{"api-key"},
+			WantErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := validateSecretEnvAnnotation(&types.FunctionDeployment{Annotations: &tc.Annotations, Secrets: tc.Secrets})
+			if (err != nil) != tc.WantErr {
+				t.Errorf("want error: %v, got: %v", tc.WantErr, err)
+			}
+		})
+	}
+}
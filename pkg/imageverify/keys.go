@@ -0,0 +1,92 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package imageverify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// PublicKey is a trusted key, which is one of *ecdsa.PublicKey, *rsa.PublicKey or
+// ed25519.PublicKey
+type PublicKey struct {
+	id  string
+	key crypto.PublicKey
+}
+
+// ID is a short fingerprint of the key, which identifies it in verification results
+func (k PublicKey) ID() string {
+	return k.id
+}
+
+// LoadPublicKeys reads the PEM encoded public keys in a file, such as cosign.pub
+func LoadPublicKeys(path string) ([]PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read public keys: %s", err.Error())
+	}
+
+	return ParsePublicKeys(data)
+}
+
+// ParsePublicKeys parses each "PUBLIC KEY" PEM block in data. ECDSA, RSA and Ed25519
+// keys are supported.
+func ParsePublicKeys(data []byte) ([]PublicKey, error) {
+	keys := []PublicKey{}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse public key: %s", err.Error())
+		}
+
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type: %T", key)
+		}
+
+		keys = append(keys, PublicKey{id: keyID(block.Bytes), key: key})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM encoded public keys found")
+	}
+
+	return keys, nil
+}
+
+// verify checks the signature of msg in the way cosign signs: a SHA256 digest for ECDSA
+// and RSA, and the message itself for Ed25519
+func (k PublicKey) verify(msg, signature []byte) bool {
+	digest := sha256.Sum256(msg)
+
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, msg, signature)
+	default:
+		return false
+	}
+}
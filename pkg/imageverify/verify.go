@@ -0,0 +1,355 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package imageverify checks that a container image was signed with one of a set of
+// trusted public keys before it is deployed as a function. Signatures and attestations
+// are read from the registry in the format written by cosign, which stores them next to
+// the image under the tags sha256-<digest>.sig and sha256-<digest>.att.
+package imageverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	// ModeSignature requires a signature over the image's digest
+	ModeSignature = "signature"
+
+	// ModeAttestation requires a signed in-toto attestation about the image's digest
+	ModeAttestation = "attestation"
+
+	// SignatureAnnotation holds the base64 signature of a simple signing layer
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	simpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	dsseMediaType          = "application/vnd.dsse.envelope.v1+json"
+	inTotoPayloadType      = "application/vnd.in-toto+json"
+	signatureType          = "cosign container image signature"
+
+	// maxBlobSize bounds the signature and attestation layers read from a registry
+	maxBlobSize = 4 * 1024 * 1024
+)
+
+// ErrNotVerified is returned when an image has no signature or attestation which can be
+// verified with the trusted keys
+var ErrNotVerified = errors.New("image is not signed by a trusted key")
+
+// Result describes how an image was verified
+type Result struct {
+	// Mode is ModeSignature or ModeAttestation
+	Mode string
+
+	// Digest of the image which was verified
+	Digest string
+
+	// KeyID identifies the public key which verified the image
+	KeyID string
+
+	// PredicateType of the attestation, empty for signatures
+	PredicateType string
+}
+
+// Verifier checks images against a set of trusted public keys
+type Verifier struct {
+	mode          string
+	keys          []PublicKey
+	predicateType string
+}
+
+// New creates a Verifier for mode, which is ModeSignature or ModeAttestation. When
+// predicateType is set, only attestations of that type are accepted.
+func New(mode string, keys []PublicKey, predicateType string) (*Verifier, error) {
+	switch mode {
+	case ModeSignature, ModeAttestation:
+	default:
+		return nil, fmt.Errorf("image verification mode must be signature or attestation, got: %q", mode)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one public key is required for image verification")
+	}
+
+	if predicateType != "" && mode != ModeAttestation {
+		return nil, fmt.Errorf("a predicate type can only be required in attestation mode")
+	}
+
+	return &Verifier{
+		mode:          mode,
+		keys:          keys,
+		predicateType: predicateType,
+	}, nil
+}
+
+// Mode returns ModeSignature or ModeAttestation
+func (v *Verifier) Mode() string {
+	return v.mode
+}
+
+// Verify resolves the image to a digest, and checks that it has a signature or
+// attestation which verifies with one of the trusted keys. An image without one is
+// reported with ErrNotVerified, other errors mean the registry could not be read. The
+// registry is accessed with the credentials from keychain, or anonymously when nil.
+func (v *Verifier) Verify(ctx context.Context, image string, keychain authn.Keychain) (*Result, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image reference: %s", err.Error())
+	}
+
+	auth := remote.WithAuth(authn.Anonymous)
+	if keychain != nil {
+		auth = remote.WithAuthFromKeychain(keychain)
+	}
+	options := []remote.Option{remote.WithContext(ctx), auth}
+
+	digest, err := resolveDigest(ref, options)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := ".sig"
+	if v.mode == ModeAttestation {
+		suffix = ".att"
+	}
+	repo := ref.Context()
+	tag := repo.Tag(strings.Replace(digest.String(), ":", "-", 1) + suffix)
+
+	desc, err := remote.Get(tag, options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: no %s found for %s", ErrNotVerified, v.mode, digest)
+		}
+		return nil, fmt.Errorf("unable to fetch %s of %s: %s", v.mode, image, err.Error())
+	}
+
+	manifest, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s manifest of %s: %s", v.mode, image, err.Error())
+	}
+
+	reason := fmt.Sprintf("no %s found for %s", v.mode, digest)
+	for _, layer := range manifest.Layers {
+		var result *Result
+		var err error
+
+		switch {
+		case v.mode == ModeSignature && layer.MediaType == simpleSigningMediaType:
+			result, err = v.verifySignature(repo, layer, digest, options)
+		case v.mode == ModeAttestation && layer.MediaType == dsseMediaType:
+			result, err = v.verifyAttestation(repo, layer, digest, options)
+		default:
+			continue
+		}
+
+		if err == nil {
+			return result, nil
+		}
+		reason = err.Error()
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotVerified, reason)
+}
+
+// simpleSigning is the payload signed by cosign for an image signature
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+func (v *Verifier) verifySignature(repo name.Repository, layer v1.Descriptor, digest v1.Hash, options []remote.Option) (*Result, error) {
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("signature layer %s has no valid %s annotation", layer.Digest, SignatureAnnotation)
+	}
+
+	payload, err := fetchBlob(repo, layer.Digest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.verifyAny(payload, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := simpleSigning{}
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return nil, fmt.Errorf("unable to parse signature payload: %s", err.Error())
+	}
+
+	if signed.Critical.Type != signatureType {
+		return nil, fmt.Errorf("signature has unexpected type: %q", signed.Critical.Type)
+	}
+
+	if signed.Critical.Image.DockerManifestDigest != digest.String() {
+		return nil, fmt.Errorf("signature is for %s, not %s", signed.Critical.Image.DockerManifestDigest, digest)
+	}
+
+	return &Result{
+		Mode:   ModeSignature,
+		Digest: digest.String(),
+		KeyID:  key.id,
+	}, nil
+}
+
+// envelope is a DSSE envelope, which wraps an in-toto statement
+type envelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+	Signatures  []struct {
+		Sig string `json:"sig"`
+	} `json:"signatures"`
+}
+
+// statement is the part of an in-toto statement which is checked
+type statement struct {
+	PredicateType string `json:"predicateType"`
+	Subject       []struct {
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+}
+
+func (v *Verifier) verifyAttestation(repo name.Repository, layer v1.Descriptor, digest v1.Hash, options []remote.Option) (*Result, error) {
+	blob, err := fetchBlob(repo, layer.Digest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelope{}
+	if err := json.Unmarshal(blob, &env); err != nil {
+		return nil, fmt.Errorf("unable to parse attestation envelope: %s", err.Error())
+	}
+
+	if env.PayloadType != inTotoPayloadType {
+		return nil, fmt.Errorf("attestation has unexpected payload type: %q", env.PayloadType)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode attestation payload: %s", err.Error())
+	}
+
+	var key *PublicKey
+	for _, sig := range env.Signatures {
+		signature, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if key, err = v.verifyAny(pae(env.PayloadType, payload), signature); err == nil {
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("attestation is not signed by a trusted key")
+	}
+
+	st := statement{}
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, fmt.Errorf("unable to parse attestation statement: %s", err.Error())
+	}
+
+	if v.predicateType != "" && st.PredicateType != v.predicateType {
+		return nil, fmt.Errorf("attestation has predicate type %q, want %q", st.PredicateType, v.predicateType)
+	}
+
+	for _, subject := range st.Subject {
+		if subject.Digest[digest.Algorithm] == digest.Hex {
+			return &Result{
+				Mode:          ModeAttestation,
+				Digest:        digest.String(),
+				KeyID:         key.id,
+				PredicateType: st.PredicateType,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("attestation is not about %s", digest)
+}
+
+// verifyAny returns the first trusted key which verifies the signature of msg
+func (v *Verifier) verifyAny(msg, signature []byte) (*PublicKey, error) {
+	for i := range v.keys {
+		if v.keys[i].verify(msg, signature) {
+			return &v.keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("signature does not verify with a trusted key")
+}
+
+// pae is the DSSE pre-authentication encoding, which is what an envelope's signatures
+// are computed over
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// resolveDigest returns the digest of the image, using the registry for a tag
+func resolveDigest(ref name.Reference, options []remote.Option) (v1.Hash, error) {
+	if d, ok := ref.(name.Digest); ok {
+		return v1.NewHash(d.DigestStr())
+	}
+
+	desc, err := remote.Head(ref, options...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("unable to resolve digest of %s: %s", ref, err.Error())
+	}
+
+	return desc.Digest, nil
+}
+
+// fetchBlob reads a blob from the repository, the registry client checks its digest
+func fetchBlob(repo name.Repository, digest v1.Hash, options []remote.Option) ([]byte, error) {
+	layer, err := remote.Layer(repo.Digest(digest.String()), options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %s", digest, err.Error())
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %s", digest, err.Error())
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxBlobSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %s", digest, err.Error())
+	}
+
+	if len(data) > maxBlobSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", digest, maxBlobSize)
+	}
+
+	return data, nil
+}
+
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// keyID is a short fingerprint of a DER encoded public key
+func keyID(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,343 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package imageverify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// fakeRegistry serves manifests and blobs from memory for a single repository, and
+// requires basic auth when username is set
+type fakeRegistry struct {
+	host      string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+
+	username string
+	password string
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	reg := &fakeRegistry{
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/openfaas/figlet/")
+
+		if reg.username != "" {
+			if u, p, ok := r.BasicAuth(); !ok || u != reg.username || p != reg.password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case strings.HasPrefix(path, "manifests/"):
+			body, ok := reg.manifests[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+			w.Header().Set("Docker-Content-Digest", digestOf(body))
+			if r.Method != http.MethodHead {
+				w.Write(body)
+			}
+		case strings.HasPrefix(path, "blobs/"):
+			body, ok := reg.blobs[strings.TrimPrefix(path, "blobs/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	reg.host = strings.TrimPrefix(srv.URL, "http://")
+	return reg
+}
+
+func digestOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// pushImage adds an image manifest under tag and returns its digest
+func (reg *fakeRegistry) pushImage(tag string) string {
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"},"layers":[]}`)
+	digest := digestOf(manifest)
+	reg.manifests[tag] = manifest
+	reg.manifests[digest] = manifest
+	return digest
+}
+
+// pushLayers adds a manifest under tag whose layers are the given blobs
+func (reg *fakeRegistry) pushLayers(tag, mediaType string, blobs [][]byte, annotations []map[string]string) {
+	type descriptor struct {
+		MediaType   string            `json:"mediaType"`
+		Size        int               `json:"size"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+
+	config := []byte("{}")
+	reg.blobs[digestOf(config)] = config
+
+	layers := []descriptor{}
+	for i, blob := range blobs {
+		reg.blobs[digestOf(blob)] = blob
+		layers = append(layers, descriptor{MediaType: mediaType, Size: len(blob), Digest: digestOf(blob), Annotations: annotations[i]})
+	}
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Size: len(config), Digest: digestOf(config)},
+		"layers":        layers,
+	})
+	reg.manifests[tag] = manifest
+}
+
+func sigTag(digest, suffix string) string {
+	return strings.Replace(digest, ":", "-", 1) + suffix
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, []PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParsePublicKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, keys
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, msg []byte) string {
+	sum := sha256.Sum256(msg)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func signaturePayload(image, digest string) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, image, digest))
+}
+
+func (reg *fakeRegistry) sign(t *testing.T, key *ecdsa.PrivateKey, digest, signedDigest string) {
+	payload := signaturePayload(reg.host+"/openfaas/figlet", signedDigest)
+	reg.pushLayers(sigTag(digest, ".sig"), simpleSigningMediaType, [][]byte{payload}, []map[string]string{
+		{SignatureAnnotation: sign(t, key, payload)},
+	})
+}
+
+func (reg *fakeRegistry) attest(t *testing.T, key *ecdsa.PrivateKey, digest, predicateType string) {
+	statement, _ := json.Marshal(map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"predicateType": predicateType,
+		"subject": []map[string]interface{}{
+			{"name": reg.host + "/openfaas/figlet", "digest": map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")}},
+		},
+		"predicate": map[string]string{},
+	})
+
+	env, _ := json.Marshal(map[string]interface{}{
+		"payloadType": inTotoPayloadType,
+		"payload":     base64.StdEncoding.EncodeToString(statement),
+		"signatures":  []map[string]string{{"keyid": "", "sig": sign(t, key, pae(inTotoPayloadType, statement))}},
+	})
+
+	reg.pushLayers(sigTag(digest, ".att"), dsseMediaType, [][]byte{env}, []map[string]string{nil})
+}
+
+func Test_Verify_Signature(t *testing.T) {
+	reg := newFakeRegistry(t)
+	key, keys := newKey(t)
+
+	digest := reg.pushImage("latest")
+	reg.sign(t, key, digest, digest)
+
+	v, err := New(ModeSignature, keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := v.Verify(context.Background(), reg.host+"/openfaas/figlet:latest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Digest != digest {
+		t.Errorf("want digest %s, got %s", digest, result.Digest)
+	}
+	if result.KeyID != keys[0].ID() {
+		t.Errorf("want key %s, got %s", keys[0].ID(), result.KeyID)
+	}
+	if result.Mode != ModeSignature {
+		t.Errorf("want mode %s, got %s", ModeSignature, result.Mode)
+	}
+}
+
+func Test_Verify_Rejected(t *testing.T) {
+	cases := []struct {
+		name string
+		push func(t *testing.T, reg *fakeRegistry, trusted, untrusted *ecdsa.PrivateKey) string
+	}{
+		{
+			name: "unsigned",
+			push: func(t *testing.T, reg *fakeRegistry, trusted, untrusted *ecdsa.PrivateKey) string {
+				return reg.pushImage("latest")
+			},
+		},
+		{
+			name: "untrusted key",
+			push: func(t *testing.T, reg *fakeRegistry, trusted, untrusted *ecdsa.PrivateKey) string {
+				digest := reg.pushImage("latest")
+				reg.sign(t, untrusted, digest, digest)
+				return digest
+			},
+		},
+		{
+			name: "signature for another digest",
+			push: func(t *testing.T, reg *fakeRegistry, trusted, untrusted *ecdsa.PrivateKey) string {
+				digest := reg.pushImage("latest")
+				other := "sha256:" + strings.Repeat("0", 64)
+				reg.sign(t, trusted, digest, other)
+				return digest
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := newFakeRegistry(t)
+			trusted, keys := newKey(t)
+			untrusted, _ := newKey(t)
+
+			tc.push(t, reg, trusted, untrusted)
+
+			v, err := New(ModeSignature, keys, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = v.Verify(context.Background(), reg.host+"/openfaas/figlet:latest", nil)
+			if !errors.Is(err, ErrNotVerified) {
+				t.Fatalf("want ErrNotVerified, got: %v", err)
+			}
+		})
+	}
+}
+
+// staticKeychain returns the same credentials for every registry
+type staticKeychain authn.AuthConfig
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return authn.FromConfig(authn.AuthConfig(k)), nil
+}
+
+func Test_Verify_Credentials(t *testing.T) {
+	reg := newFakeRegistry(t)
+	reg.username, reg.password = "robot", "s3cr3t"
+
+	key, keys := newKey(t)
+	digest := reg.pushImage("latest")
+	reg.sign(t, key, digest, digest)
+
+	v, err := New(ModeSignature, keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), reg.host+"/openfaas/figlet:latest", nil)
+	if err == nil || errors.Is(err, ErrNotVerified) {
+		t.Fatalf("want a registry error without credentials, got: %v", err)
+	}
+
+	keychain := staticKeychain{Username: "robot", Password: "s3cr3t"}
+	if _, err := v.Verify(context.Background(), reg.host+"/openfaas/figlet:latest", keychain); err != nil {
+		t.Fatalf("want image verified with credentials, got: %s", err)
+	}
+}
+
+func Test_Verify_Attestation(t *testing.T) {
+	reg := newFakeRegistry(t)
+	key, keys := newKey(t)
+
+	digest := reg.pushImage("latest")
+	reg.attest(t, key, digest, "https://slsa.dev/provenance/v1")
+
+	v, err := New(ModeAttestation, keys, "https://slsa.dev/provenance/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := v.Verify(context.Background(), reg.host+"/openfaas/figlet@"+digest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.PredicateType != "https://slsa.dev/provenance/v1" {
+		t.Errorf("want predicate type https://slsa.dev/provenance/v1, got %s", result.PredicateType)
+	}
+
+	v, err = New(ModeAttestation, keys, "https://spdx.dev/Document")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(context.Background(), reg.host+"/openfaas/figlet@"+digest, nil); !errors.Is(err, ErrNotVerified) {
+		t.Fatalf("want ErrNotVerified for another predicate type, got: %v", err)
+	}
+}
+
+func Test_New_Invalid(t *testing.T) {
+	_, keys := newKey(t)
+
+	if _, err := New("sbom", keys, ""); err == nil {
+		t.Errorf("want error for an unknown mode")
+	}
+	if _, err := New(ModeSignature, nil, ""); err == nil {
+		t.Errorf("want error without keys")
+	}
+	if _, err := New(ModeSignature, keys, "https://slsa.dev/provenance/v1"); err == nil {
+		t.Errorf("want error for a predicate type in signature mode")
+	}
+}
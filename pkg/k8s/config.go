@@ -3,11 +3,20 @@
 
 package k8s
 
+import (
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/imageverify"
+	corev1 "k8s.io/api/core/v1"
+)
+
 // ProbeConfig holds the deployment liveness and readiness options
 type ProbeConfig struct {
 	InitialDelaySeconds int32
 	TimeoutSeconds      int32
 	PeriodSeconds       int32
+	SuccessThreshold    int32
+	FailureThreshold    int32
 }
 
 // DeploymentConfig holds the global deployment options
@@ -16,7 +25,54 @@ type DeploymentConfig struct {
 	HTTPProbe       bool
 	ReadinessProbe  *ProbeConfig
 	LivenessProbe   *ProbeConfig
+	// ImagePullPolicy is the pull policy of function containers, Always when empty
+	ImagePullPolicy corev1.PullPolicy
+	// RevisionHistoryLimit is the number of old ReplicaSets kept for each function
+	RevisionHistoryLimit int32
+	// DefaultRequests are used for the memory and CPU requests which a function does not set
+	DefaultRequests corev1.ResourceList
+	// DefaultLimits are used for the memory and CPU limits which a function does not set
+	DefaultLimits corev1.ResourceList
+	// ResolveImageDigests pins the image of each function to the digest of its tag at
+	// deploy time, unless the function opts out
+	ResolveImageDigests bool
+	// ImageVerifier checks the signature or attestations of images before they are
+	// deployed. It is nil when image verification is disabled.
+	ImageVerifier *imageverify.Verifier
 	// SetNonRootUser will override the function image user to ensure that it is not root. When
 	// true, the user will set to 12000 for all functions.
 	SetNonRootUser bool
+	// MaxFunctionTimeout is the largest timeout that a function can request through
+	// the com.openfaas.timeout annotation. It is set to the provider's write timeout.
+	MaxFunctionTimeout time.Duration
+	// SecretDecryption configures the init container which decrypts encrypted secrets
+	// for functions. It is nil when secret encryption is disabled.
+	SecretDecryption *SecretDecryptionConfig
+}
+
+// SecretDecryptionConfig configures the decrypt-secrets init container, which runs the
+// faas-netes image to decrypt a function's secrets into an in-memory volume
+type SecretDecryptionConfig struct {
+	// Image is the faas-netes image to run
+	Image string
+
+	// KEK is the kind of key encryption key, "file" or "vault-transit"
+	KEK string
+
+	// KEKFile is the path to the key for the file KEK
+	KEKFile string
+
+	// KEKHostPath is a directory on each node which holds the key for the file KEK,
+	// under the base name of KEKFile
+	KEKHostPath string
+
+	// VaultAddr is the address of Vault for the vault-transit KEK
+	VaultAddr string
+
+	// VaultKey is the name of the transit key
+	VaultKey string
+
+	// VaultTokenSecret is a Secret in the function's namespace which holds a token able
+	// to decrypt with the transit key, under the key "token"
+	VaultTokenSecret string
 }
@@ -0,0 +1,104 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImagePullPolicyAnnotation overrides the provider's image pull policy for a function
+// with one of Always, IfNotPresent or Never
+const ImagePullPolicyAnnotation = "com.openfaas.image.pullPolicy"
+
+// ReadImagePullPolicy returns the pull policy set by the function's annotation, or an
+// empty policy when it is not set
+func ReadImagePullPolicy(request types.FunctionDeployment) (corev1.PullPolicy, error) {
+	if request.Annotations == nil {
+		return "", nil
+	}
+
+	v, ok := (*request.Annotations)[ImagePullPolicyAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	switch policy := corev1.PullPolicy(strings.TrimSpace(v)); policy {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%s must be Always, IfNotPresent or Never, got: %q", ImagePullPolicyAnnotation, v)
+	}
+}
+
+// ImagePullPolicy returns the pull policy for the function's container. The function's
+// annotation takes precedence over the provider's policy, which is Always unless set
+// otherwise. An image pinned to a digest can not change, so Always is relaxed to
+// IfNotPresent for it, to save a round trip to the registry for every new Pod.
+func (f *FunctionFactory) ImagePullPolicy(request types.FunctionDeployment) (corev1.PullPolicy, error) {
+	policy, err := ReadImagePullPolicy(request)
+	if err != nil || policy != "" {
+		return policy, err
+	}
+
+	policy = f.Config.ImagePullPolicy
+	if policy == "" {
+		policy = corev1.PullAlways
+	}
+
+	if policy == corev1.PullAlways && isDigestReference(request.Image) {
+		return corev1.PullIfNotPresent, nil
+	}
+
+	return policy, nil
+}
+
+// isDigestReference is true when the image is referenced by its digest,
+// i.e. ghcr.io/openfaas/figlet@sha256:...
+func isDigestReference(image string) bool {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return false
+	}
+
+	_, ok := ref.(name.Digest)
+	return ok
+}
+
+// ConfigureDefaultResources fills in the memory and CPU requests and limits which the
+// function did not set from the defaults in DeploymentConfig. A default request is not
+// applied when it would exceed the function's own limit, nor a default limit when it
+// would be below the function's own request, as Kubernetes would reject either.
+func (f *FunctionFactory) ConfigureDefaultResources(resources *corev1.ResourceRequirements) {
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+
+	for name, qty := range f.Config.DefaultRequests {
+		if _, ok := resources.Requests[name]; ok {
+			continue
+		}
+		if limit, ok := resources.Limits[name]; ok && qty.Cmp(limit) > 0 {
+			continue
+		}
+		resources.Requests[name] = qty.DeepCopy()
+	}
+
+	for name, qty := range f.Config.DefaultLimits {
+		if _, ok := resources.Limits[name]; ok {
+			continue
+		}
+		if request, ok := resources.Requests[name]; ok && qty.Cmp(request) < 0 {
+			continue
+		}
+		resources.Limits[name] = qty.DeepCopy()
+	}
+}
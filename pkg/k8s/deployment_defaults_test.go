@@ -0,0 +1,110 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func Test_ConfigureDefaultResources(t *testing.T) {
+	f := mockFactory()
+	f.Config.DefaultRequests = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+	}
+	f.Config.DefaultLimits = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("256Mi"),
+	}
+
+	t.Run("unset resources use the defaults", func(t *testing.T) {
+		resources := &corev1.ResourceRequirements{}
+		f.ConfigureDefaultResources(resources)
+
+		if got := resources.Requests.Memory().String(); got != "128Mi" {
+			t.Errorf("want memory request 128Mi, got %s", got)
+		}
+		if got := resources.Requests.Cpu().String(); got != "100m" {
+			t.Errorf("want cpu request 100m, got %s", got)
+		}
+		if got := resources.Limits.Memory().String(); got != "256Mi" {
+			t.Errorf("want memory limit 256Mi, got %s", got)
+		}
+		if _, ok := resources.Limits[corev1.ResourceCPU]; ok {
+			t.Errorf("want no cpu limit")
+		}
+	})
+
+	t.Run("function resources are kept", func(t *testing.T) {
+		resources := &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		}
+		f.ConfigureDefaultResources(resources)
+
+		if got := resources.Requests.Cpu().String(); got != "500m" {
+			t.Errorf("want cpu request 500m, got %s", got)
+		}
+		if got := resources.Limits.Memory().String(); got != "64Mi" {
+			t.Errorf("want memory limit 64Mi, got %s", got)
+		}
+		if _, ok := resources.Requests[corev1.ResourceMemory]; ok {
+			t.Errorf("want no memory request above the function's limit of 64Mi")
+		}
+	})
+}
+
+func Test_ImagePullPolicy(t *testing.T) {
+	digest := "ghcr.io/openfaas/figlet@sha256:" + strings.Repeat("a", 64)
+
+	cases := []struct {
+		name       string
+		configured corev1.PullPolicy
+		image      string
+		annotation string
+		want       corev1.PullPolicy
+	}{
+		{"defaults to Always", "", "ghcr.io/openfaas/figlet:latest", "", corev1.PullAlways},
+		{"uses the provider's policy", corev1.PullNever, "ghcr.io/openfaas/figlet:latest", "", corev1.PullNever},
+		{"digest relaxes Always", corev1.PullAlways, digest, "", corev1.PullIfNotPresent},
+		{"digest keeps Never", corev1.PullNever, digest, "", corev1.PullNever},
+		{"annotation overrides the provider", corev1.PullAlways, "ghcr.io/openfaas/figlet:latest", "IfNotPresent", corev1.PullIfNotPresent},
+		{"annotation overrides a digest", corev1.PullAlways, digest, "Always", corev1.PullAlways},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mockFactory()
+			f.Config.ImagePullPolicy = tc.configured
+
+			request := types.FunctionDeployment{Service: "figlet", Image: tc.image}
+			if tc.annotation != "" {
+				request.Annotations = &map[string]string{ImagePullPolicyAnnotation: tc.annotation}
+			}
+
+			got, err := f.ImagePullPolicy(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ReadImagePullPolicy_Invalid(t *testing.T) {
+	request := types.FunctionDeployment{
+		Service:     "figlet",
+		Annotations: &map[string]string{ImagePullPolicyAnnotation: "always"},
+	}
+
+	if _, err := ReadImagePullPolicy(request); err == nil {
+		t.Fatalf("want error for an invalid pull policy")
+	}
+}
@@ -0,0 +1,52 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	appslister "k8s.io/client-go/listers/apps/v1"
+)
+
+// FunctionAnnotationLookup reads the annotations of a function from the Deployment
+// informer cache. The annotations carry per-function settings for the invocation proxy.
+type FunctionAnnotationLookup struct {
+	DefaultNamespace string
+	DeploymentLister appslister.DeploymentLister
+}
+
+// NewFunctionAnnotationLookup creates a FunctionAnnotationLookup for the default namespace
+func NewFunctionAnnotationLookup(ns string, lister appslister.DeploymentLister) *FunctionAnnotationLookup {
+	return &FunctionAnnotationLookup{
+		DefaultNamespace: ns,
+		DeploymentLister: lister,
+	}
+}
+
+// Annotations returns the annotations of the function's pod template, the name may
+// be suffixed with the namespace i.e. "figlet.openfaas-fn". A function which is not
+// found has no annotations, it is reported by the resolver instead.
+func (l *FunctionAnnotationLookup) Annotations(name string) (map[string]string, error) {
+	functionName := name
+	namespace := getNamespace(name, l.DefaultNamespace)
+	if err := verifyNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(name, ".") {
+		functionName = strings.TrimSuffix(name, "."+namespace)
+	}
+
+	deployment, err := l.DeploymentLister.Deployments(namespace).Get(functionName)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading \"%s.%s\": %s", functionName, namespace, err.Error())
+	}
+
+	return deployment.Spec.Template.Annotations, nil
+}
@@ -0,0 +1,39 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appslister "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_FunctionAnnotationLookup(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"}}
+	deployment.Spec.Template.Annotations = map[string]string{"com.openfaas.retry.attempts": "3"}
+	indexer.Add(deployment)
+
+	lookup := NewFunctionAnnotationLookup("openfaas-fn", appslister.NewDeploymentLister(indexer))
+
+	annotations, err := lookup.Annotations("figlet.openfaas-fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if annotations["com.openfaas.retry.attempts"] != "3" {
+		t.Fatalf("want the annotations of the pod template, got: %v", annotations)
+	}
+
+	annotations, err = lookup.Annotations("unknown")
+	if err != nil || annotations != nil {
+		t.Fatalf("want no annotations and no error for an unknown function, got: %v %v", annotations, err)
+	}
+
+	if _, err := lookup.Annotations("figlet.kube-system"); err == nil {
+		t.Fatal("want error for the kube-system namespace")
+	}
+}
@@ -12,7 +12,9 @@ import (
 const EnvProcessName = "fprocess"
 
 // AsFunctionStatus reads a Deployment object into an OpenFaaS FunctionStatus, parsing the
-// Deployment and Container spec into a simplified summary of the Function
+// Deployment and Container spec into a simplified summary of the Function. The Image is
+// the one which is running. When it was pinned to the digest of a tag, the tag is in the
+// ImageTagAnnotation annotation.
 func AsFunctionStatus(item appsv1.Deployment) *types.FunctionStatus {
 	var replicas uint64
 	if item.Spec.Replicas != nil {
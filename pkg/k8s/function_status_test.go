@@ -123,3 +123,31 @@ func Test_AsFunctionStatus(t *testing.T) {
 	}
 
 }
+
+func Test_AsFunctionStatus_PinnedImage(t *testing.T) {
+	image := "ghcr.io/openfaas/figlet@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	deploy := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "figlet", Namespace: "openfaas-fn"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{ImageTagAnnotation: "ghcr.io/openfaas/figlet:latest"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "figlet", Image: image}},
+				},
+			},
+		},
+	}
+
+	status := AsFunctionStatus(deploy)
+
+	if status.Image != image {
+		t.Errorf("incorrect Image: expected %s, got %s", image, status.Image)
+	}
+
+	if got := (*status.Annotations)[ImageTagAnnotation]; got != "ghcr.io/openfaas/figlet:latest" {
+		t.Errorf("incorrect %s annotation: expected %s, got %q", ImageTagAnnotation, "ghcr.io/openfaas/figlet:latest", got)
+	}
+}
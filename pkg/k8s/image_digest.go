@@ -0,0 +1,98 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	types "github.com/openfaas/faas-provider/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// ResolveDigestAnnotation overrides the provider's resolve_image_digests setting for
+	// a function with "true" or "false"
+	ResolveDigestAnnotation = "com.openfaas.image.resolveDigest"
+
+	// ImageTagAnnotation records the image which a function was deployed with, before its
+	// tag was resolved to a digest
+	ImageTagAnnotation = "com.openfaas.image.tag"
+)
+
+// ReadResolveDigest returns whether the function's image should be resolved to a digest,
+// the function's annotation takes precedence over the provider's setting
+func ReadResolveDigest(request types.FunctionDeployment, configured bool) (bool, error) {
+	if request.Annotations == nil {
+		return configured, nil
+	}
+
+	v, ok := (*request.Annotations)[ResolveDigestAnnotation]
+	if !ok {
+		return configured, nil
+	}
+
+	resolve, err := strconv.ParseBool(v)
+	if err != nil {
+		return configured, k8serrors.NewBadRequest(fmt.Sprintf("%s must be true or false, got: %q", ResolveDigestAnnotation, v))
+	}
+
+	return resolve, nil
+}
+
+// PinImageDigest replaces a tagged image in the request with the digest which the tag
+// currently points to, so that every replica runs the same code even if the tag is
+// pushed again. The original image is recorded in ImageTagAnnotation. Images which are
+// already pinned to a digest are left as they are. The registry is accessed with the
+// credentials from keychain, see RegistryKeychain. An invalid image or annotation is
+// returned as a bad request, other errors are from the registry.
+func (f *FunctionFactory) PinImageDigest(ctx context.Context, request *types.FunctionDeployment, keychain authn.Keychain) error {
+	resolve, err := ReadResolveDigest(*request, f.Config.ResolveImageDigests)
+	if err != nil {
+		return err
+	}
+
+	if request.Annotations == nil {
+		request.Annotations = &map[string]string{}
+	}
+	annotations := *request.Annotations
+
+	// A tag left over from an earlier deployment would no longer describe the image
+	delete(annotations, ImageTagAnnotation)
+
+	if !resolve {
+		return nil
+	}
+
+	ref, err := name.ParseReference(request.Image)
+	if err != nil {
+		return k8serrors.NewBadRequest(fmt.Sprintf("unable to parse image reference: %s", err.Error()))
+	}
+
+	tag, ok := ref.(name.Tag)
+	if !ok {
+		return nil
+	}
+
+	desc, err := remote.Head(tag, remote.WithAuthFromKeychain(keychain), remote.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to resolve digest of %s: %s", request.Image, err.Error())
+	}
+
+	annotations[ImageTagAnnotation] = request.Image
+	request.Image = pinnedImage(request.Image, tag, desc.Digest.String())
+
+	return nil
+}
+
+// pinnedImage replaces the tag of image with digest, keeping the repository as it was
+// written, i.e. figlet:latest becomes figlet@sha256:...
+func pinnedImage(image string, tag name.Tag, digest string) string {
+	return strings.TrimSuffix(image, ":"+tag.TagStr()) + "@" + digest
+}
@@ -0,0 +1,214 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// newFakeRegistry serves the manifest of openfaas/figlet:latest, and nothing else
+func newFakeRegistry(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/openfaas/figlet/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			w.Header().Set("Content-Length", "100")
+			w.Header().Set("Docker-Content-Digest", testDigest)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func Test_PinImageDigest(t *testing.T) {
+	registry := newFakeRegistry(t)
+
+	f := mockFactory()
+	f.Config.ResolveImageDigests = true
+
+	image := registry + "/openfaas/figlet:latest"
+	request := types.FunctionDeployment{Service: "figlet", Image: image}
+
+	if err := f.PinImageDigest(context.Background(), &request, f.RegistryKeychain(context.Background(), "openfaas-fn", request)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := registry + "/openfaas/figlet@" + testDigest
+	if request.Image != want {
+		t.Errorf("want image %s, got %s", want, request.Image)
+	}
+
+	if got := (*request.Annotations)[ImageTagAnnotation]; got != image {
+		t.Errorf("want %s annotation %s, got %q", ImageTagAnnotation, image, got)
+	}
+}
+
+func Test_PinImageDigest_Disabled(t *testing.T) {
+	f := mockFactory()
+	f.Config.ResolveImageDigests = true
+
+	image := "127.0.0.1:1/openfaas/figlet:latest"
+	request := types.FunctionDeployment{
+		Service: "figlet",
+		Image:   image,
+		Annotations: &map[string]string{
+			ResolveDigestAnnotation: "false",
+			ImageTagAnnotation:      "127.0.0.1:1/openfaas/figlet:0.1.0",
+		},
+	}
+
+	if err := f.PinImageDigest(context.Background(), &request, f.RegistryKeychain(context.Background(), "openfaas-fn", request)); err != nil {
+		t.Fatal(err)
+	}
+
+	if request.Image != image {
+		t.Errorf("want image %s, got %s", image, request.Image)
+	}
+
+	if _, ok := (*request.Annotations)[ImageTagAnnotation]; ok {
+		t.Errorf("want stale %s annotation removed", ImageTagAnnotation)
+	}
+}
+
+func Test_PinImageDigest_UnknownTag(t *testing.T) {
+	registry := newFakeRegistry(t)
+
+	f := mockFactory()
+	f.Config.ResolveImageDigests = true
+
+	request := types.FunctionDeployment{Service: "figlet", Image: registry + "/openfaas/figlet:missing"}
+
+	err := f.PinImageDigest(context.Background(), &request, f.RegistryKeychain(context.Background(), "openfaas-fn", request))
+	if err == nil {
+		t.Fatalf("want error for a tag which does not exist")
+	}
+	if k8serrors.IsBadRequest(err) {
+		t.Fatalf("want a registry error not to be a bad request, got: %s", err)
+	}
+}
+
+func Test_PinImageDigest_InvalidRequest(t *testing.T) {
+	f := mockFactory()
+	f.Config.ResolveImageDigests = true
+
+	cases := []types.FunctionDeployment{
+		{Service: "figlet", Image: "openfaas/FIGLET:latest"},
+		{Service: "figlet", Image: "openfaas/figlet:latest", Annotations: &map[string]string{ResolveDigestAnnotation: "maybe"}},
+	}
+
+	for _, request := range cases {
+		err := f.PinImageDigest(context.Background(), &request, f.RegistryKeychain(context.Background(), "openfaas-fn", request))
+		if !k8serrors.IsBadRequest(err) {
+			t.Fatalf("want a bad request for %s, got: %v", request.Image, err)
+		}
+	}
+}
+
+// newAuthenticatedRegistry serves the manifest of private/figlet:latest to clients which
+// authenticate with basic auth as user, and challenges all others
+func newAuthenticatedRegistry(t *testing.T, user, password string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/private/figlet/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			w.Header().Set("Content-Length", "100")
+			w.Header().Set("Docker-Content-Digest", testDigest)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func Test_PinImageDigest_PullSecretCredentials(t *testing.T) {
+	registry := newAuthenticatedRegistry(t, "robot", "s3cr3t")
+	image := registry + "/private/figlet:latest"
+
+	credential, err := newRegistrySecret(RegistryCredential{
+		Name:      "registry-auth",
+		Namespace: "openfaas-fn",
+		Server:    registry,
+		Username:  "robot",
+		Password:  "s3cr3t",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		objects []runtime.Object
+		secrets []string
+	}{
+		{
+			name:    "function secret",
+			objects: []runtime.Object{credential},
+			secrets: []string{"registry-auth"},
+		},
+		{
+			name: "service account",
+			objects: []runtime.Object{credential, &corev1.ServiceAccount{
+				ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "openfaas-fn"},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-auth"}},
+			}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mockFactory()
+			f.Client = fake.NewSimpleClientset(tc.objects...)
+			f.Config.ResolveImageDigests = true
+
+			request := types.FunctionDeployment{Service: "figlet", Image: image, Secrets: tc.secrets}
+			keychain := f.RegistryKeychain(context.Background(), "openfaas-fn", request)
+
+			if err := f.PinImageDigest(context.Background(), &request, keychain); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := registry + "/private/figlet@" + testDigest; request.Image != want {
+				t.Errorf("want image %s, got %s", want, request.Image)
+			}
+		})
+	}
+
+	f := mockFactory()
+	f.Config.ResolveImageDigests = true
+	request := types.FunctionDeployment{Service: "figlet", Image: image}
+
+	if err := f.PinImageDigest(context.Background(), &request, f.RegistryKeychain(context.Background(), "openfaas-fn", request)); err == nil {
+		t.Fatal("want error without credentials for the registry")
+	}
+}
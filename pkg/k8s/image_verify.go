@@ -0,0 +1,78 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	types "github.com/openfaas/faas-provider/types"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// ImageVerifiedAnnotation records how the function's image was verified before it was
+	// deployed, "signature" or "attestation"
+	ImageVerifiedAnnotation = "com.openfaas.image.verified"
+
+	// ImageVerifiedDigestAnnotation is the digest of the image which was verified
+	ImageVerifiedDigestAnnotation = "com.openfaas.image.verified.digest"
+
+	// ImageVerifiedKeyAnnotation identifies the public key which verified the image
+	ImageVerifiedKeyAnnotation = "com.openfaas.image.verified.key"
+
+	// ImageVerifiedPredicateTypeAnnotation is the predicate type of the attestation
+	ImageVerifiedPredicateTypeAnnotation = "com.openfaas.image.verified.predicateType"
+)
+
+// VerifyImage checks the function's image with the ImageVerifier of the factory, and
+// records the result in the function's annotations. A verified image is pinned to the
+// digest which was verified, so that pushing the tag again can not bypass verification.
+// Verification annotations in the request are always discarded, as they can only be
+// set by the provider. The registry is accessed with the credentials from keychain.
+// An invalid image reference is reported as a bad request, an unverified image with
+// imageverify.ErrNotVerified, and any other error means the registry could not be read.
+func (f *FunctionFactory) VerifyImage(ctx context.Context, request *types.FunctionDeployment, keychain authn.Keychain) error {
+	if request.Annotations == nil {
+		request.Annotations = &map[string]string{}
+	}
+	annotations := *request.Annotations
+
+	for k := range annotations {
+		if k == ImageVerifiedAnnotation || strings.HasPrefix(k, ImageVerifiedAnnotation+".") {
+			delete(annotations, k)
+		}
+	}
+
+	if f.Config.ImageVerifier == nil {
+		return nil
+	}
+
+	ref, err := name.ParseReference(request.Image)
+	if err != nil {
+		return k8serrors.NewBadRequest(fmt.Sprintf("unable to parse image reference: %s", err.Error()))
+	}
+
+	result, err := f.Config.ImageVerifier.Verify(ctx, request.Image, keychain)
+	if err != nil {
+		return err
+	}
+
+	annotations[ImageVerifiedAnnotation] = result.Mode
+	annotations[ImageVerifiedDigestAnnotation] = result.Digest
+	annotations[ImageVerifiedKeyAnnotation] = result.KeyID
+	if result.PredicateType != "" {
+		annotations[ImageVerifiedPredicateTypeAnnotation] = result.PredicateType
+	}
+
+	if tag, ok := ref.(name.Tag); ok {
+		annotations[ImageTagAnnotation] = request.Image
+		request.Image = pinnedImage(request.Image, tag, result.Digest)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+)
+
+func Test_VerifyImage_DiscardsRequestedAnnotations(t *testing.T) {
+	f := mockFactory()
+
+	request := types.FunctionDeployment{
+		Service: "figlet",
+		Image:   "ghcr.io/openfaas/figlet:latest",
+		Annotations: &map[string]string{
+			ImageVerifiedAnnotation:         "signature",
+			ImageVerifiedDigestAnnotation:   "sha256:0123",
+			ImageVerifiedKeyAnnotation:      "forged",
+			"com.openfaas.image.verifiedBy": "kept",
+		},
+	}
+
+	if err := f.VerifyImage(context.Background(), &request, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	annotations := *request.Annotations
+	for _, k := range []string{ImageVerifiedAnnotation, ImageVerifiedDigestAnnotation, ImageVerifiedKeyAnnotation} {
+		if _, ok := annotations[k]; ok {
+			t.Errorf("want %s removed from the request", k)
+		}
+	}
+
+	if annotations["com.openfaas.image.verifiedBy"] != "kept" {
+		t.Errorf("want unrelated annotations kept")
+	}
+
+	if request.Image != "ghcr.io/openfaas/figlet:latest" {
+		t.Errorf("want image unchanged without a verifier, got %s", request.Image)
+	}
+}
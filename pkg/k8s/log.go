@@ -8,7 +8,7 @@ import (
 	"log"
 	"strings"
 
-	"github.com/openfaas/faas-provider/logs"
+	"github.com/openfaas/faas-netes/pkg/logs"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -16,13 +16,16 @@ import (
 type LogRequestor struct {
 	client            kubernetes.Interface
 	functionNamespace string
+	watcher           *PodWatcher
 }
 
-// NewLogRequestor returns a new logs.Requestor that uses kail to select and follow pod logs
-func NewLogRequestor(client kubernetes.Interface, functionNamespace string) *LogRequestor {
+// NewLogRequestor returns a new logs.Requestor which finds function Pods through the
+// shared PodWatcher and follows their logs
+func NewLogRequestor(client kubernetes.Interface, functionNamespace string, watcher *PodWatcher) *LogRequestor {
 	return &LogRequestor{
 		client:            client,
 		functionNamespace: functionNamespace,
+		watcher:           watcher,
 	}
 }
 
@@ -36,7 +39,26 @@ func (l LogRequestor) Query(ctx context.Context, r logs.Request) (<-chan logs.Me
 		ns = r.Namespace
 	}
 
-	logStream, err := GetLogs(ctx, l.client, r.Name, ns, int64(r.Tail), r.Since, r.Follow)
+	filter, err := logs.NewFilter(r)
+	if err != nil {
+		log.Printf("LogRequestor: invalid filter: %s\n", err)
+		return nil, err
+	}
+
+	opts := LogOptions{
+		Instance:  r.Instance,
+		Container: r.Container,
+		Previous:  r.Previous,
+		Tail:      int64(r.Tail),
+		Since:     r.Since,
+		Until:     r.Until,
+		Follow:    r.Follow,
+		Filter:    filter,
+		JSON:      r.JSON,
+		Events:    r.Events,
+	}
+
+	logStream, err := GetLogs(ctx, l.client, l.watcher, r.Name, ns, opts)
 	if err != nil {
 		log.Printf("LogRequestor: get logs failed: %s\n", err)
 		return nil, err
@@ -53,7 +75,11 @@ func (l LogRequestor) Query(ctx context.Context, r logs.Request) (<-chan logs.Me
 				Text:      msg.Text,
 				Name:      msg.FunctionName,
 				Instance:  msg.PodName,
+				Container: msg.Container,
 				Namespace: msg.Namespace,
+				Level:     msg.Level,
+				Fields:    msg.Fields,
+				Event:     msg.Event,
 			}
 		}
 	}()
@@ -4,17 +4,13 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"strings"
 	"time"
 
-	"github.com/pkg/errors"
-	"k8s.io/client-go/informers/internalinterfaces"
-
-	"k8s.io/client-go/tools/cache"
-
-	"k8s.io/client-go/informers"
+	"github.com/openfaas/faas-netes/pkg/logs"
 	"k8s.io/client-go/kubernetes"
 
 	corev1 "k8s.io/api/core/v1"
@@ -23,14 +19,21 @@ import (
 )
 
 const (
-	// podInformerResync is the period between cache syncs in the pod informer
-	podInformerResync = 5 * time.Second
-
 	// defaultLogSince is the fallback log stream history
 	defaultLogSince = 5 * time.Minute
 
 	// LogBufferSize number of log messages that may be buffered
 	LogBufferSize = 500 * 2
+
+	// logMergeBufferSize is the number of log messages held to order the output of
+	// several Pods by timestamp
+	logMergeBufferSize = 5000
+
+	// logStreamRetryDelay is the delay before re-opening a followed log stream which
+	// ended while its Pod still exists, it doubles up to logStreamMaxRetryDelay while
+	// the stream can not be opened, such as during a container's crash loop back-off
+	logStreamRetryDelay    = time.Second
+	logStreamMaxRetryDelay = 30 * time.Second
 )
 
 // Log is the object which will be used together with the template to generate
@@ -48,72 +51,305 @@ type Log struct {
 	// FunctionName of the pod
 	FunctionName string `json:"FunctionName"`
 
+	// Container which wrote the message
+	Container string `json:"container"`
+
+	// Event is true for messages describing a change to the instance, rather than
+	// being written by the function
+	Event bool `json:"event,omitempty"`
+
+	// Level of a parsed JSON log line
+	Level string `json:"level,omitempty"`
+
+	// Fields of a parsed JSON log line
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
 	// Timestamp of the message
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// GetLogs returns a channel of logs for the given function
-func GetLogs(ctx context.Context, client kubernetes.Interface, functionName, namespace string, tail int64, since *time.Time, follow bool) (<-chan Log, error) {
-	added, err := startFunctionPodInformer(ctx, client, functionName, namespace)
+// LogOptions selects which function instances and containers logs are read from
+type LogOptions struct {
+	// Instance is the optional name of a single Pod to read logs from
+	Instance string
+
+	// Container is the optional container to read from, when empty the function's
+	// container is used. logs.AllContainers reads from every container.
+	Container string
+
+	// Previous reads the logs of the previously terminated container
+	Previous bool
+
+	// Tail is the number of lines to read from the end of the log, <=0 means all lines
+	Tail int64
+
+	// Since is the optional time to read logs from
+	Since *time.Time
+
+	// Until is the optional time to stop reading logs at, it is not used with Follow
+	Until *time.Time
+
+	// Follow keeps the stream open for new log lines
+	Follow bool
+
+	// Filter drops the log lines which do not match, nil returns every line
+	Filter *logs.Filter
+
+	// JSON parses log lines which are JSON objects into the Log's Level and Fields
+	JSON bool
+
+	// Events adds messages when instances are started or terminate
+	Events bool
+}
+
+// GetLogs returns a channel of logs for the given function, the function's Pods are
+// found through the shared PodWatcher.
+func GetLogs(ctx context.Context, client kubernetes.Interface, watcher *PodWatcher, functionName, namespace string, opts LogOptions) (<-chan Log, error) {
+	events, err := watcher.Subscribe(ctx, functionName, namespace, opts.Instance)
 	if err != nil {
 		return nil, err
 	}
 
-	logs := make(chan Log, LogBufferSize)
+	// the existing Pods are buffered by Subscribe, so they can be checked before any
+	// output is written
+	initial := []PodEvent{}
+	for len(events) > 0 {
+		initial = append(initial, <-events)
+	}
+
+	if opts.Container != "" && opts.Container != logs.AllContainers && !hasContainer(initial, opts.Container) {
+		return nil, fmt.Errorf("%w: no container %q found in the instances of %s", logs.ErrBadRequest, opts.Container, functionName)
+	}
+
+	messages := make(chan Log, LogBufferSize)
+	out := (<-chan Log)(messages)
+
+	// history from several instances is merged by timestamp, this isn't possible when
+	// following because a quiet instance would hold back the output of the others
+	if !opts.Follow {
+		out = mergeByTimestamp(ctx, messages, logMergeBufferSize)
+	}
 
 	go func() {
 		var watching uint
-		defer close(logs)
+		defer close(messages)
 
 		finished := make(chan error)
 
+		// each Pod's streams are cancelled when it is deleted
+		streams := map[string]context.CancelFunc{}
+		defer func() {
+			for _, cancel := range streams {
+				cancel()
+			}
+		}()
+
+		notify := func(p *corev1.Pod, text string) {
+			if !opts.Events {
+				return
+			}
+
+			select {
+			case messages <- Log{
+				Text:         text,
+				Namespace:    namespace,
+				PodName:      p.Name,
+				FunctionName: functionName,
+				Timestamp:    time.Now(),
+				Event:        true,
+			}:
+			case <-ctx.Done():
+			}
+		}
+
+		handle := func(event PodEvent) {
+			p := event.Pod
+
+			switch event.Type {
+			case PodTerminated:
+				notify(p, fmt.Sprintf("instance %s terminated: %s", p.Name, event.Reason))
+
+			case PodDeleted:
+				if cancel, ok := streams[p.Name]; ok {
+					cancel()
+					delete(streams, p.Name)
+				}
+
+				reason := event.Reason
+				if reason == "" {
+					reason = "deleted"
+				}
+				notify(p, fmt.Sprintf("instance %s terminated: %s", p.Name, reason))
+
+			case PodAdded:
+				if !event.Initial {
+					notify(p, fmt.Sprintf("instance %s started", p.Name))
+				}
+
+				containers := podContainers(p, functionName, opts.Container)
+				if len(containers) == 0 {
+					log.Printf("Logger: no container %q found in %s\n", opts.Container, p.Name)
+					return
+				}
+
+				podCtx, cancel := context.WithCancel(ctx)
+				streams[p.Name] = cancel
+
+				for _, container := range containers {
+					watching++
+					go func(container string) {
+						finished <- followPodLogs(podCtx, client.CoreV1().Pods(namespace), p.Name, functionName, container, namespace, opts, messages)
+					}(container)
+				}
+			}
+		}
+
+		for _, event := range initial {
+			handle(event)
+		}
+
+		// nothing would ever finish when no stream was started
+		if watching == 0 && !opts.Follow {
+			return
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
+				// wait for the log streams to stop writing before closing messages
+				for ; watching > 0; watching-- {
+					<-finished
+				}
 				return
 			case <-finished:
 				watching--
-				if watching == 0 && !follow {
+				if watching == 0 && !opts.Follow {
 					return
 				}
-			case p := <-added:
-				watching++
-				go func() {
-					finished <- podLogs(ctx, client.CoreV1().Pods(namespace), p, functionName, namespace, tail, since, follow, logs)
-				}()
+			case event := <-events:
+				handle(event)
 			}
 		}
 	}()
 
-	return logs, nil
+	return out, nil
+}
+
+// hasContainer returns true when any of the Pods has the named container
+func hasContainer(events []PodEvent, container string) bool {
+	for _, event := range events {
+		for _, c := range event.Pod.Spec.Containers {
+			if c.Name == container {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// podContainers returns the containers to read logs from. By default this is the container
+// named after the function, or the first container when it has been renamed.
+func podContainers(pod *corev1.Pod, functionName, container string) []string {
+	containers := []string{}
+	for _, c := range pod.Spec.Containers {
+		switch {
+		case container == logs.AllContainers:
+			containers = append(containers, c.Name)
+		case container == "" && c.Name == functionName, container != "" && c.Name == container:
+			return []string{c.Name}
+		}
+	}
+
+	if container == "" && len(pod.Spec.Containers) > 0 {
+		return []string{pod.Spec.Containers[0].Name}
+	}
+
+	return containers
 }
 
-// podLogs returns a stream of logs lines from the specified pod
-func podLogs(ctx context.Context, i v1.PodInterface, pod, container, namespace string, tail int64, since *time.Time, follow bool, dst chan<- Log) error {
-	log.Printf("Logger: starting log stream for %s\n", pod)
-	defer log.Printf("Logger: stopping log stream for %s\n", pod)
+// followPodLogs reads the logs of a container. When following, the stream is re-opened
+// whenever it ends, such as when the container crashes and is restarted, until ctx is
+// cancelled because the Pod was deleted. Lines which were already read are skipped.
+func followPodLogs(ctx context.Context, i v1.PodInterface, pod, functionName, container, namespace string, opts LogOptions, dst chan<- Log) error {
+	var after time.Time
+	delay := logStreamRetryDelay
 
-	opts := &corev1.PodLogOptions{
-		Follow:     follow,
+	for {
+		last, err := podLogs(ctx, i, pod, functionName, container, namespace, opts, after, dst)
+		if !opts.Follow || ctx.Err() != nil {
+			return err
+		}
+
+		if err != nil {
+			log.Printf("Logger: unable to follow %s/%s, retrying in %s: %s\n", pod, container, delay, err)
+		} else {
+			delay = logStreamRetryDelay
+		}
+
+		if last.After(after) {
+			after = last
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if err != nil {
+			delay *= 2
+			if delay > logStreamMaxRetryDelay {
+				delay = logStreamMaxRetryDelay
+			}
+		}
+	}
+}
+
+// podLogs streams the log lines of a container in the specified pod to dst. When after
+// is set, the stream starts from that time and lines up to and including it are skipped.
+// The timestamp of the last line read is returned.
+func podLogs(ctx context.Context, i v1.PodInterface, pod, functionName, container, namespace string, opts LogOptions, after time.Time, dst chan<- Log) (time.Time, error) {
+	log.Printf("Logger: starting log stream for %s/%s\n", pod, container)
+	defer log.Printf("Logger: stopping log stream for %s/%s\n", pod, container)
+
+	logOpts := &corev1.PodLogOptions{
+		Follow:     opts.Follow,
 		Timestamps: true,
 		Container:  container,
+		Previous:   opts.Previous,
+	}
+
+	if opts.Tail > 0 {
+		logOpts.TailLines = &opts.Tail
 	}
 
-	if tail > 0 {
-		opts.TailLines = &tail
+	if logOpts.TailLines == nil || opts.Since != nil {
+		logOpts.SinceSeconds = parseSince(opts.Since)
 	}
 
-	if opts.TailLines == nil || since != nil {
-		opts.SinceSeconds = parseSince(since)
+	// a re-opened stream continues from the last line which was read
+	if !after.IsZero() {
+		logOpts.TailLines = nil
+		logOpts.SinceSeconds = nil
+		logOpts.SinceTime = &metav1.Time{Time: after}
+		logOpts.Previous = false
 	}
 
-	stream, err := i.GetLogs(pod, opts).Stream(context.TODO())
+	// when reading from every container, prefix each line so that the output can be told apart
+	prefix := ""
+	if opts.Container == logs.AllContainers {
+		prefix = "[" + container + "] "
+	}
+
+	stream, err := i.GetLogs(pod, logOpts).Stream(ctx)
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
-	defer stream.Close()
 
-	done := make(chan error)
+	// last is only written by the reader, and read once it has exited
+	var last time.Time
+
+	done := make(chan error, 1)
 	go func() {
 		reader := bufio.NewReader(stream)
 		for {
@@ -123,18 +359,62 @@ func podLogs(ctx context.Context, i v1.PodInterface, pod, container, namespace s
 				return
 			}
 			msg, ts := extractTimestampAndMsg(string(bytes.Trim(line, "\x00")))
-			dst <- Log{Timestamp: ts, Text: msg, PodName: pod, FunctionName: container}
+
+			if !after.IsZero() && !ts.After(after) {
+				continue
+			}
+			last = ts
+
+			// lines are read in order, so the stream is finished at the first line after until
+			if opts.Until != nil && ts.After(*opts.Until) {
+				done <- io.EOF
+				return
+			}
+
+			entry := Log{
+				Timestamp:    ts,
+				Text:         msg,
+				Namespace:    namespace,
+				PodName:      pod,
+				FunctionName: functionName,
+				Container:    container,
+			}
+
+			if opts.JSON {
+				if text, level, fields, ok := logs.ParseJSON(msg); ok {
+					entry.Text = text
+					entry.Level = level
+					entry.Fields = fields
+				}
+			}
+
+			// filter on the raw line so that the values of JSON fields can be matched
+			if !opts.Filter.Match(msg, entry.Level) {
+				continue
+			}
+
+			entry.Text = prefix + entry.Text
+			select {
+			case dst <- entry:
+			case <-ctx.Done():
+				done <- ctx.Err()
+				return
+			}
 		}
 	}()
 
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		// closing the stream unblocks the reader, which must exit before dst can be closed
+		stream.Close()
+		<-done
+		return last, ctx.Err()
 	case err := <-done:
+		stream.Close()
 		if err != io.EOF {
-			return err
+			return last, err
 		}
-		return nil
+		return last, nil
 	}
 }
 
@@ -164,83 +444,3 @@ func parseSince(r *time.Time) *int64 {
 	since = int64(time.Since(*r).Seconds())
 	return &since
 }
-
-// startFunctionPodInformer will gather the list of existing Pods for the function, it will then watch
-// and watch for newly added or deleted function instances.
-func startFunctionPodInformer(ctx context.Context, client kubernetes.Interface, functionName, namespace string) (<-chan string, error) {
-	functionSelector := &metav1.LabelSelector{
-		MatchLabels: map[string]string{"faas_function": functionName},
-	}
-	selector, err := metav1.LabelSelectorAsSelector(functionSelector)
-	if err != nil {
-		err = errors.Wrap(err, "unable to build function selector")
-		log.Printf("PodInformer: %s", err)
-		return nil, err
-	}
-
-	log.Printf("PodInformer: starting informer for %s in: %s\n", selector.String(), namespace)
-	factory := informers.NewFilteredSharedInformerFactory(
-		client,
-		podInformerResync,
-		namespace,
-		withLabels(selector.String()),
-	)
-
-	podInformer := factory.Core().V1().Pods()
-	podsResp, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
-	if err != nil {
-		log.Printf("PodInformer: %s", err)
-		return nil, err
-	}
-
-	pods := podsResp.Items
-	if len(pods) == 0 {
-		err = errors.New("no matching instances found")
-		log.Printf("PodInformer: %s", err)
-		return nil, err
-	}
-
-	// prepare channel with enough space for the current instance set
-	added := make(chan string, len(pods))
-	podInformer.Informer().AddEventHandler(&podLoggerEventHandler{
-		added: added,
-	})
-
-	// will add existing pods to the chan and then listen for any new pods
-	go podInformer.Informer().Run(ctx.Done())
-	go func() {
-		<-ctx.Done()
-		close(added)
-	}()
-
-	return added, nil
-}
-
-func withLabels(selector string) internalinterfaces.TweakListOptionsFunc {
-	return func(opts *metav1.ListOptions) {
-		opts.LabelSelector = selector
-	}
-}
-
-type podLoggerEventHandler struct {
-	cache.ResourceEventHandler
-	added   chan<- string
-	deleted chan<- string
-}
-
-func (h *podLoggerEventHandler) OnAdd(obj interface{}, isInInitialList bool) {
-	pod := obj.(*corev1.Pod)
-	log.Printf("PodInformer: adding instance: %s", pod.Name)
-	h.added <- pod.Name
-}
-
-func (h *podLoggerEventHandler) OnUpdate(oldObj, newObj interface{}) {
-	// purposefully empty, we don't need to do anything for logs on update
-}
-
-func (h *podLoggerEventHandler) OnDelete(obj interface{}) {
-	// this may not be needed, the log stream Reader _should_ close on its own without
-	// us needing to watch and close it
-	// pod := obj.(*corev1.Pod)
-	// h.deleted <- pod.Name
-}
@@ -0,0 +1,65 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"container/heap"
+	"context"
+)
+
+// mergeByTimestamp orders the log messages from several Pods by their timestamp. The
+// lines of each Pod arrive in order, but are interleaved with the other Pods as they are
+// read. Up to size messages are held back, so output is fully ordered when the history
+// fits within the buffer, and the oldest message is emitted each time the buffer is full.
+func mergeByTimestamp(ctx context.Context, in <-chan Log, size int) <-chan Log {
+	out := make(chan Log, LogBufferSize)
+
+	go func() {
+		defer close(out)
+
+		pending := &logHeap{}
+		emit := func() bool {
+			select {
+			case out <- heap.Pop(pending).(Log):
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for msg := range in {
+			heap.Push(pending, msg)
+			if pending.Len() > size && !emit() {
+				return
+			}
+		}
+
+		for pending.Len() > 0 {
+			if !emit() {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// logHeap is a min-heap of log messages by timestamp
+type logHeap []Log
+
+func (h logHeap) Len() int { return len(h) }
+
+func (h logHeap) Less(i, j int) bool { return h[i].Timestamp.Before(h[j].Timestamp) }
+
+func (h logHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *logHeap) Push(x interface{}) { *h = append(*h, x.(Log)) }
+
+func (h *logHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,69 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_mergeByTimestamp_OrdersInstances(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	in := make(chan Log, 10)
+	in <- Log{PodName: "figlet-a", Timestamp: at(1)}
+	in <- Log{PodName: "figlet-a", Timestamp: at(4)}
+	in <- Log{PodName: "figlet-b", Timestamp: at(2)}
+	in <- Log{PodName: "figlet-a", Timestamp: at(5)}
+	in <- Log{PodName: "figlet-b", Timestamp: at(3)}
+	close(in)
+
+	got := []int{}
+	for msg := range mergeByTimestamp(context.Background(), in, 10) {
+		got = append(got, int(msg.Timestamp.Sub(start).Seconds()))
+	}
+
+	want := []int{1, 2, 3, 4, 5}
+	if len(got) != len(want) {
+		t.Fatalf("want %d messages, got: %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want order: %v, got: %v", want, got)
+		}
+	}
+}
+
+func Test_mergeByTimestamp_BoundedBuffer(t *testing.T) {
+	start := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	in := make(chan Log)
+	out := mergeByTimestamp(context.Background(), in, 2)
+
+	for i := 0; i < 3; i++ {
+		in <- Log{Timestamp: start.Add(time.Duration(i) * time.Second)}
+	}
+
+	// the oldest message is released once the buffer is full
+	select {
+	case msg := <-out:
+		if !msg.Timestamp.Equal(start) {
+			t.Fatalf("want oldest message, got: %s", msg.Timestamp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want a message once the buffer is full")
+	}
+
+	close(in)
+	count := 0
+	for range out {
+		count++
+	}
+
+	if count != 2 {
+		t.Fatalf("want remaining 2 messages, got: %d", count)
+	}
+}
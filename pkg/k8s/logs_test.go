@@ -0,0 +1,142 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/logs"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_podContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "istio-proxy"},
+				{Name: "figlet"},
+			},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		function  string
+		container string
+		want      []string
+	}{
+		{name: "default is the function's container", function: "figlet", want: []string{"figlet"}},
+		{name: "default falls back to the first container", function: "renamed", want: []string{"istio-proxy"}},
+		{name: "named container", function: "figlet", container: "istio-proxy", want: []string{"istio-proxy"}},
+		{name: "missing container", function: "figlet", container: "debug", want: []string{}},
+		{name: "all containers", function: "figlet", container: logs.AllContainers, want: []string{"istio-proxy", "figlet"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := podContainers(pod, tc.function, tc.container)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want containers: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_GetLogs_ReopensFollowedStreamAfterEOF(t *testing.T) {
+	pod := newFunctionPod("figlet-1", "figlet")
+	pod.Spec.Containers = []corev1.Container{{Name: "figlet"}}
+	client := fake.NewSimpleClientset(pod)
+
+	// the container crashes after the first stream, which ends it, then the restarted
+	// container's stream repeats the last line read due to the second precision of sinceTime
+	streams := []string{
+		"2024-01-01T00:00:01.000000000Z started\n2024-01-01T00:00:02.000000000Z crashed\n",
+		"2024-01-01T00:00:02.000000000Z crashed\n2024-01-01T00:00:03.000000000Z restarted\n",
+	}
+
+	var lock sync.Mutex
+	var sinceTimes []*time.Time
+	client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "log" {
+			return false, nil, nil
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		opts := action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+		if opts.SinceTime != nil {
+			sinceTimes = append(sinceTimes, &opts.SinceTime.Time)
+		} else {
+			sinceTimes = append(sinceTimes, nil)
+		}
+
+		body := ""
+		if i := len(sinceTimes) - 1; i < len(streams) {
+			body = streams[i]
+		}
+		return true, &runtime.Unknown{Raw: []byte(body)}, nil
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := GetLogs(ctx, client, watcher, "figlet", "openfaas-fn", LogOptions{Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for len(got) < 3 {
+		select {
+		case msg := <-messages:
+			got = append(got, msg.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for logs of the restarted container, got: %v", got)
+		}
+	}
+
+	want := []string{"started\n", "crashed\n", "restarted\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	wantSince := time.Date(2024, 1, 1, 0, 0, 2, 0, time.UTC)
+	if len(sinceTimes) < 2 || sinceTimes[0] != nil || sinceTimes[1] == nil || !sinceTimes[1].Equal(wantSince) {
+		t.Fatalf("want the stream to be re-opened from %s, got: %v", wantSince, sinceTimes)
+	}
+}
+
+func Test_GetLogs_MissingContainer(t *testing.T) {
+	pod := newFunctionPod("figlet-1", "figlet")
+	pod.Spec.Containers = []corev1.Container{{Name: "figlet"}}
+	client := fake.NewSimpleClientset(pod)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := GetLogs(ctx, client, watcher, "figlet", "openfaas-fn", LogOptions{Container: "debug"})
+	if !errors.Is(err, logs.ErrBadRequest) {
+		t.Fatalf("want a bad request for a container which does not exist, got: %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// podSubscriberBuffer is the number of events which may be queued for a subscriber
+// in addition to the Pods which exist when it subscribes
+const podSubscriberBuffer = 10
+
+// podInformerIdleTimeout is how long the informer for a namespace keeps running after
+// its last subscriber has gone, so that repeated log requests share one watch
+const podInformerIdleTimeout = time.Minute
+
+// PodEventType is the change to a function's Pod
+type PodEventType string
+
+const (
+	// PodAdded is sent for each existing Pod when subscribing, and for Pods added later
+	PodAdded PodEventType = "added"
+
+	// PodTerminated is sent when a container within the Pod terminates, i.e. on a crash
+	PodTerminated PodEventType = "terminated"
+
+	// PodDeleted is sent when the Pod is deleted
+	PodDeleted PodEventType = "deleted"
+)
+
+// PodEvent is sent to subscribers when a function's Pod changes
+type PodEvent struct {
+	Type PodEventType
+	Pod  *corev1.Pod
+
+	// Initial is true for Pods which existed when subscribing
+	Initial bool
+
+	// Reason explains why the containers of the Pod terminated, when known
+	Reason string
+}
+
+// PodWatcher shares a single informer per namespace for the Pods of all functions, so
+// that concurrent log requests do not each create a watch on the Kubernetes API. Log
+// requests subscribe to the Pods of a function and are removed when their context is
+// cancelled. Informers are started on the first request for a namespace and are stopped
+// once the namespace has had no subscribers for the idle timeout, such as when it is no
+// longer enabled for functions, or when the stop channel is closed.
+type PodWatcher struct {
+	client      kubernetes.Interface
+	stopCh      <-chan struct{}
+	idleTimeout time.Duration
+
+	lock       sync.Mutex
+	namespaces map[string]*namespacePods
+}
+
+// namespacePods holds the informer and the subscribers for a single namespace
+type namespacePods struct {
+	informer cache.SharedIndexInformer
+	lister   corelisters.PodLister
+
+	// refs counts the subscribers, and requests which are subscribing, it is guarded
+	// by the PodWatcher's lock along with idle
+	refs int
+	idle *time.Timer
+	stop context.CancelFunc
+
+	lock        sync.Mutex
+	subscribers map[*podSubscriber]struct{}
+}
+
+// podSubscriber receives the events for the Pods of a function, or of a single instance when set
+type podSubscriber struct {
+	functionName string
+	instance     string
+
+	events chan PodEvent
+	done   <-chan struct{}
+	seen   map[string]bool
+
+	// queue holds the events which have not yet been delivered to events, so that a
+	// subscriber which is slow to read does not hold up the informer
+	queueLock sync.Mutex
+	queue     []PodEvent
+	wake      chan struct{}
+}
+
+// NewPodWatcher creates a PodWatcher, its informers are stopped when stopCh is closed
+func NewPodWatcher(client kubernetes.Interface, stopCh <-chan struct{}) *PodWatcher {
+	return &PodWatcher{
+		client:      client,
+		stopCh:      stopCh,
+		idleTimeout: podInformerIdleTimeout,
+		namespaces:  map[string]*namespacePods{},
+	}
+}
+
+// Subscribe returns a channel of events for the function's Pods, starting with the existing
+// Pods and followed by any changes. The channel is not closed, the subscription ends when
+// ctx is cancelled. An error is returned if the function has no matching Pods.
+func (w *PodWatcher) Subscribe(ctx context.Context, functionName, namespace, instance string) (<-chan PodEvent, error) {
+	pods, err := w.informerFor(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := labels.SelectorFromSet(map[string]string{"faas_function": functionName})
+
+	// hold the lock so that Pods added after listing are not missed, the seen set
+	// prevents a Pod from being sent twice when its event is still queued
+	pods.lock.Lock()
+	defer pods.lock.Unlock()
+
+	existing, err := pods.lister.Pods(namespace).List(selector)
+	if err != nil {
+		log.Printf("PodWatcher: %s", err)
+		w.release(namespace, pods)
+		return nil, err
+	}
+
+	sub := &podSubscriber{
+		functionName: functionName,
+		instance:     instance,
+		events:       make(chan PodEvent, len(existing)+podSubscriberBuffer),
+		done:         ctx.Done(),
+		seen:         map[string]bool{},
+		wake:         make(chan struct{}, 1),
+	}
+
+	for _, pod := range existing {
+		if sub.matches(pod) {
+			sub.seen[pod.Name] = true
+			sub.events <- PodEvent{Type: PodAdded, Pod: pod, Initial: true}
+		}
+	}
+
+	if len(sub.seen) == 0 {
+		err := errors.New("no matching instances found")
+		log.Printf("PodWatcher: %s", err)
+		w.release(namespace, pods)
+		return nil, err
+	}
+
+	pods.subscribers[sub] = struct{}{}
+	go sub.deliver()
+
+	go func() {
+		<-ctx.Done()
+
+		pods.lock.Lock()
+		delete(pods.subscribers, sub)
+		pods.lock.Unlock()
+
+		w.release(namespace, pods)
+	}()
+
+	return sub.events, nil
+}
+
+// informerFor returns the informer for the namespace, starting it and waiting for
+// its cache to sync on the first request. The caller holds a reference to the informer
+// until it calls release.
+func (w *PodWatcher) informerFor(ctx context.Context, namespace string) (*namespacePods, error) {
+	w.lock.Lock()
+	pods, ok := w.namespaces[namespace]
+	if !ok {
+		log.Printf("PodWatcher: starting informer for function Pods in: %s\n", namespace)
+
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			w.client,
+			0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = "faas_function"
+			}),
+		)
+
+		podInformer := factory.Core().V1().Pods()
+		pods = &namespacePods{
+			informer:    podInformer.Informer(),
+			lister:      podInformer.Lister(),
+			subscribers: map[*podSubscriber]struct{}{},
+		}
+		pods.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    pods.onAdd,
+			UpdateFunc: pods.onUpdate,
+			DeleteFunc: pods.onDelete,
+		})
+
+		informerCtx, stop := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-w.stopCh:
+				stop()
+			case <-informerCtx.Done():
+			}
+		}()
+		pods.stop = stop
+
+		factory.Start(informerCtx.Done())
+		w.namespaces[namespace] = pods
+	}
+
+	pods.refs++
+	if pods.idle != nil {
+		pods.idle.Stop()
+		pods.idle = nil
+	}
+	w.lock.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), pods.informer.HasSynced) {
+		w.release(namespace, pods)
+		return nil, fmt.Errorf("timed out waiting for the Pod cache of: %s", namespace)
+	}
+
+	return pods, nil
+}
+
+// release drops a reference to the informer of the namespace, and stops it when
+// no new subscriber has arrived within the idle timeout.
+func (w *PodWatcher) release(namespace string, pods *namespacePods) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	pods.refs--
+	if pods.refs > 0 {
+		return
+	}
+
+	pods.idle = time.AfterFunc(w.idleTimeout, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+
+		if pods.refs > 0 || w.namespaces[namespace] != pods {
+			return
+		}
+
+		log.Printf("PodWatcher: stopping idle informer for function Pods in: %s\n", namespace)
+		delete(w.namespaces, namespace)
+		pods.stop()
+	})
+}
+
+// onAdd sends a new Pod to each subscriber for its function
+func (n *namespacePods) onAdd(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	n.lock.Lock()
+	matched := []*podSubscriber{}
+	for sub := range n.subscribers {
+		if sub.matches(pod) && !sub.seen[pod.Name] {
+			sub.seen[pod.Name] = true
+			matched = append(matched, sub)
+		}
+	}
+	n.lock.Unlock()
+
+	log.Printf("PodWatcher: adding instance: %s", pod.Name)
+	n.send(matched, PodEvent{Type: PodAdded, Pod: pod})
+}
+
+// onUpdate sends an event to the subscribers of the Pod when one of its containers terminates
+func (n *namespacePods) onUpdate(oldObj, newObj interface{}) {
+	oldPod, ok := oldObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	pod, ok := newObj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	reasons := terminatedContainers(oldPod, pod)
+	if len(reasons) == 0 {
+		return
+	}
+
+	n.lock.Lock()
+	matched := []*podSubscriber{}
+	for sub := range n.subscribers {
+		if sub.seen[pod.Name] {
+			matched = append(matched, sub)
+		}
+	}
+	n.lock.Unlock()
+
+	n.send(matched, PodEvent{Type: PodTerminated, Pod: pod, Reason: strings.Join(reasons, ", ")})
+}
+
+// onDelete sends an event to the subscribers of the Pod so that its log streams can be closed
+func (n *namespacePods) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	n.lock.Lock()
+	matched := []*podSubscriber{}
+	for sub := range n.subscribers {
+		if sub.seen[pod.Name] {
+			delete(sub.seen, pod.Name)
+			matched = append(matched, sub)
+		}
+	}
+	n.lock.Unlock()
+
+	log.Printf("PodWatcher: removing instance: %s", pod.Name)
+	n.send(matched, PodEvent{Type: PodDeleted, Pod: pod, Reason: strings.Join(terminatedContainers(nil, pod), ", ")})
+}
+
+// send queues the event for each subscriber without blocking the informer
+func (n *namespacePods) send(subscribers []*podSubscriber, event PodEvent) {
+	for _, sub := range subscribers {
+		sub.queueLock.Lock()
+		sub.queue = append(sub.queue, event)
+		sub.queueLock.Unlock()
+
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliver writes the queued events to the subscriber's channel in order, until it
+// unsubscribes
+func (s *podSubscriber) deliver() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		s.queueLock.Lock()
+		queued := s.queue
+		s.queue = nil
+		s.queueLock.Unlock()
+
+		for _, event := range queued {
+			select {
+			case s.events <- event:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// terminatedContainers describes the containers of pod which have terminated since
+// oldPod, when oldPod is nil all terminated containers are described.
+func terminatedContainers(oldPod, pod *corev1.Pod) []string {
+	previous := map[string]corev1.ContainerStatus{}
+	if oldPod != nil {
+		for _, status := range oldPod.Status.ContainerStatuses {
+			previous[status.Name] = status
+		}
+	}
+
+	reasons := []string{}
+	for _, status := range pod.Status.ContainerStatuses {
+		terminated := status.State.Terminated
+		if terminated == nil && status.LastTerminationState.Terminated != nil {
+			// the container may already have been restarted by the time of the update
+			if old, ok := previous[status.Name]; ok && status.RestartCount > old.RestartCount {
+				terminated = status.LastTerminationState.Terminated
+			}
+		}
+
+		if terminated == nil {
+			continue
+		}
+
+		if old, ok := previous[status.Name]; ok && old.State.Terminated != nil && old.RestartCount == status.RestartCount {
+			continue
+		}
+
+		reason := terminated.Reason
+		if reason == "" {
+			reason = "Terminated"
+		}
+		reasons = append(reasons, fmt.Sprintf("%s (container: %s, exit code: %d)", reason, status.Name, terminated.ExitCode))
+	}
+
+	return reasons
+}
+
+func (s *podSubscriber) matches(pod *corev1.Pod) bool {
+	if pod.Labels["faas_function"] != s.functionName {
+		return false
+	}
+
+	return s.instance == "" || pod.Name == s.instance
+}
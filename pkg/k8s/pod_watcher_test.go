@@ -0,0 +1,253 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newFunctionPod(name, functionName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openfaas-fn",
+			Labels:    map[string]string{"faas_function": functionName},
+		},
+	}
+}
+
+func receiveEvent(t *testing.T, events <-chan PodEvent) PodEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a Pod event")
+		return PodEvent{}
+	}
+}
+
+func receivePod(t *testing.T, events <-chan PodEvent) string {
+	t.Helper()
+	return receiveEvent(t, events).Pod.Name
+}
+
+func Test_PodWatcher_SharesInformerBetweenSubscribers(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newFunctionPod("figlet-1", "figlet"),
+		newFunctionPod("env-1", "env"),
+	)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	figlet, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := watcher.Subscribe(ctx, "env", "openfaas-fn", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := receivePod(t, figlet); got != "figlet-1" {
+		t.Fatalf("want figlet-1, got: %s", got)
+	}
+	if got := receivePod(t, env); got != "env-1" {
+		t.Fatalf("want env-1, got: %s", got)
+	}
+
+	if len(watcher.namespaces) != 1 {
+		t.Fatalf("want a single informer for the namespace, got: %d", len(watcher.namespaces))
+	}
+
+	client.CoreV1().Pods("openfaas-fn").Create(context.Background(), newFunctionPod("figlet-2", "figlet"), metav1.CreateOptions{})
+
+	if got := receivePod(t, figlet); got != "figlet-2" {
+		t.Fatalf("want added Pod figlet-2, got: %s", got)
+	}
+
+	select {
+	case event := <-env:
+		t.Fatalf("want no Pods for env, got: %s", event.Pod.Name)
+	default:
+	}
+}
+
+func Test_PodWatcher_NoMatchingInstance(t *testing.T) {
+	client := fake.NewSimpleClientset(newFunctionPod("figlet-1", "figlet"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	if _, err := watcher.Subscribe(context.Background(), "figlet", "openfaas-fn", "figlet-2"); err == nil {
+		t.Fatal("want error when the instance does not exist")
+	}
+}
+
+func Test_PodWatcher_RemovesSubscriberOnCancel(t *testing.T) {
+	client := fake.NewSimpleClientset(newFunctionPod("figlet-1", "figlet"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", ""); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	pods := watcher.namespaces["openfaas-fn"]
+	for i := 0; i < 50; i++ {
+		pods.lock.Lock()
+		remaining := len(pods.subscribers)
+		pods.lock.Unlock()
+
+		if remaining == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("want subscriber to be removed when its context is cancelled")
+}
+
+func Test_PodWatcher_SendsDeleteEvent(t *testing.T) {
+	client := fake.NewSimpleClientset(newFunctionPod("figlet-1", "figlet"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event := receiveEvent(t, events); event.Type != PodAdded || !event.Initial {
+		t.Fatalf("want initial added event, got: %v", event)
+	}
+
+	client.CoreV1().Pods("openfaas-fn").Delete(context.Background(), "figlet-1", metav1.DeleteOptions{})
+
+	if event := receiveEvent(t, events); event.Type != PodDeleted || event.Pod.Name != "figlet-1" {
+		t.Fatalf("want deleted event for figlet-1, got: %v", event)
+	}
+}
+
+func Test_terminatedContainers(t *testing.T) {
+	running := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "figlet", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	restarted := &corev1.Pod{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:                 "figlet",
+					RestartCount:         1,
+					State:                corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+				},
+			},
+		},
+	}
+
+	got := terminatedContainers(running, restarted)
+	want := "OOMKilled (container: figlet, exit code: 137)"
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("want: %q, got: %v", want, got)
+	}
+
+	if got := terminatedContainers(restarted, restarted); len(got) != 0 {
+		t.Fatalf("want no terminations without a change, got: %v", got)
+	}
+}
+
+func Test_PodWatcher_StopsIdleInformer(t *testing.T) {
+	client := fake.NewSimpleClientset(newFunctionPod("figlet-1", "figlet"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+	watcher.idleTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed subscription must not keep the informer running either
+	if _, err := watcher.Subscribe(context.Background(), "nodeinfo", "openfaas-fn", ""); err == nil {
+		t.Fatal("want error for function without Pods")
+	}
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		watcher.lock.Lock()
+		_, running := watcher.namespaces["openfaas-fn"]
+		watcher.lock.Unlock()
+
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("want informer to be stopped once the namespace has no subscribers")
+}
+
+func Test_PodWatcher_SlowSubscriberDoesNotBlockOthers(t *testing.T) {
+	client := fake.NewSimpleClientset(newFunctionPod("figlet-1", "figlet"))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher := NewPodWatcher(client, stopCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// this subscriber never reads its events
+	if _, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := watcher.Subscribe(ctx, "figlet", "openfaas-fn", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveEvent(t, events)
+
+	// more events than fit in the buffer of the subscriber which does not read
+	for i := 0; i < podSubscriberBuffer*3; i++ {
+		name := fmt.Sprintf("figlet-%d", i+2)
+		client.CoreV1().Pods("openfaas-fn").Create(context.Background(), newFunctionPod(name, "figlet"), metav1.CreateOptions{})
+
+		if got := receivePod(t, events); got != name {
+			t.Fatalf("want added Pod %s, got: %s", name, got)
+		}
+	}
+}
@@ -4,35 +4,257 @@
 package k8s
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	types "github.com/openfaas/faas-provider/types"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+const (
+	// ProbeTypeAnnotation overrides the handler of the function's probes with one of
+	// "exec", "http" or "tcp"
+	ProbeTypeAnnotation = "com.openfaas.health.type"
+
+	// ProbePathAnnotation is the HTTP path checked by a "http" probe, or the file read
+	// by an "exec" probe
+	ProbePathAnnotation = "com.openfaas.health.path"
+
+	// ProbePortAnnotation is the port checked by a "http" or "tcp" probe. When the type
+	// is not set, a "http" probe is used.
+	ProbePortAnnotation = "com.openfaas.health.port"
+
+	// ProbeInitialDelayAnnotation is a duration such as "5s" to wait before probing
+	ProbeInitialDelayAnnotation = "com.openfaas.health.initialDelay"
+
+	// ProbePeriodAnnotation is a duration such as "10s" between probes
+	ProbePeriodAnnotation = "com.openfaas.health.period"
+
+	// ProbeTimeoutAnnotation is a duration such as "1s" after which a probe fails
+	ProbeTimeoutAnnotation = "com.openfaas.health.timeout"
+
+	// ProbeFailureThresholdAnnotation is the number of consecutive failures after which
+	// the function is restarted, or taken out of service
+	ProbeFailureThresholdAnnotation = "com.openfaas.health.failureThreshold"
+
+	// StartupProbeAnnotation adds a startup probe when "true", which holds off the
+	// liveness and readiness probes until the function has started
+	StartupProbeAnnotation = "com.openfaas.health.startup"
+
+	// StartupProbePeriodAnnotation is a duration between startup probes
+	StartupProbePeriodAnnotation = "com.openfaas.health.startup.period"
+
+	// StartupProbeFailureThresholdAnnotation is the number of failed startup probes
+	// after which the function is restarted. Together with the period, it gives the
+	// time allowed for the function to start.
+	StartupProbeFailureThresholdAnnotation = "com.openfaas.health.startup.failureThreshold"
+)
+
+const (
+	probeTypeExec = "exec"
+	probeTypeHTTP = "http"
+	probeTypeTCP  = "tcp"
+
+	defaultProbeFailureThreshold = 3
+
+	// the default startup probe allows a function one minute to start
+	defaultStartupPeriodSeconds    = 2
+	defaultStartupFailureThreshold = 30
+)
+
 type FunctionProbes struct {
 	Liveness  *corev1.Probe
 	Readiness *corev1.Probe
+	// Startup is nil unless the function asked for a startup probe
+	Startup *corev1.Probe
+}
+
+// ProbeSpec is the per-function override of the probes, read from its annotations.
+// Fields which were not set are zero or nil, and the provider's defaults are used.
+type ProbeSpec struct {
+	Type                string
+	Path                string
+	Port                int32
+	InitialDelaySeconds *int32
+	PeriodSeconds       *int32
+	TimeoutSeconds      *int32
+	FailureThreshold    *int32
+
+	Startup                 bool
+	StartupPeriodSeconds    *int32
+	StartupFailureThreshold *int32
+}
+
+// ReadProbeSpec parses and validates the probe annotations of a function
+func ReadProbeSpec(request types.FunctionDeployment) (ProbeSpec, error) {
+	spec := ProbeSpec{}
+	if request.Annotations == nil {
+		return spec, nil
+	}
+	annotations := *request.Annotations
+
+	if v, ok := annotations[ProbeTypeAnnotation]; ok {
+		switch t := strings.ToLower(strings.TrimSpace(v)); t {
+		case probeTypeExec, probeTypeHTTP, probeTypeTCP:
+			spec.Type = t
+		default:
+			return spec, fmt.Errorf("%s must be one of exec, http or tcp, got: %q", ProbeTypeAnnotation, v)
+		}
+	}
+
+	if v, ok := annotations[ProbePathAnnotation]; ok {
+		path := strings.TrimSpace(v)
+		if !strings.HasPrefix(path, "/") {
+			return spec, fmt.Errorf("%s must be an absolute path, got: %q", ProbePathAnnotation, v)
+		}
+		spec.Path = path
+	}
+
+	if v, ok := annotations[ProbePortAnnotation]; ok {
+		port, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+		if err != nil || port < 1 || port > 65535 {
+			return spec, fmt.Errorf("%s must be a port between 1 and 65535, got: %q", ProbePortAnnotation, v)
+		}
+		spec.Port = int32(port)
+	}
+
+	var err error
+	if spec.InitialDelaySeconds, err = readProbeSeconds(annotations, ProbeInitialDelayAnnotation, 0); err != nil {
+		return spec, err
+	}
+	if spec.PeriodSeconds, err = readProbeSeconds(annotations, ProbePeriodAnnotation, 1); err != nil {
+		return spec, err
+	}
+	if spec.TimeoutSeconds, err = readProbeSeconds(annotations, ProbeTimeoutAnnotation, 1); err != nil {
+		return spec, err
+	}
+	if spec.FailureThreshold, err = readProbeThreshold(annotations, ProbeFailureThresholdAnnotation); err != nil {
+		return spec, err
+	}
+
+	if v, ok := annotations[StartupProbeAnnotation]; ok {
+		startup, err := strconv.ParseBool(v)
+		if err != nil {
+			return spec, fmt.Errorf("%s must be true or false, got: %q", StartupProbeAnnotation, v)
+		}
+		spec.Startup = startup
+	}
+	if spec.StartupPeriodSeconds, err = readProbeSeconds(annotations, StartupProbePeriodAnnotation, 1); err != nil {
+		return spec, err
+	}
+	if spec.StartupFailureThreshold, err = readProbeThreshold(annotations, StartupProbeFailureThresholdAnnotation); err != nil {
+		return spec, err
+	}
+
+	if !spec.Startup && (spec.StartupPeriodSeconds != nil || spec.StartupFailureThreshold != nil) {
+		return spec, fmt.Errorf("%s must be true to configure the startup probe", StartupProbeAnnotation)
+	}
+
+	if spec.Path != "" && spec.Type == probeTypeTCP {
+		return spec, fmt.Errorf("%s can not be used with a tcp probe", ProbePathAnnotation)
+	}
+	if spec.Port != 0 && spec.Type == probeTypeExec {
+		return spec, fmt.Errorf("%s can not be used with an exec probe", ProbePortAnnotation)
+	}
+
+	return spec, nil
+}
+
+// readProbeSeconds parses a duration annotation into whole seconds of at least min
+func readProbeSeconds(annotations map[string]string, key string, min int32) (*int32, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a duration such as 10s, got: %q", key, v)
+	}
+
+	if d%time.Second != 0 {
+		return nil, fmt.Errorf("%s must be a whole number of seconds, got: %q", key, v)
+	}
+
+	seconds := int32(d / time.Second)
+	if seconds < min {
+		return nil, fmt.Errorf("%s must be at least %ds, got: %q", key, min, v)
+	}
+
+	return &seconds, nil
 }
 
-// MakeProbes returns the liveness and readiness probes
-// by default the health check runs `cat /tmp/.lock` every ten seconds
+// readProbeThreshold parses a failure threshold annotation, which must be at least one
+func readProbeThreshold(annotations map[string]string, key string) (*int32, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	threshold, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+	if err != nil || threshold < 1 {
+		return nil, fmt.Errorf("%s must be a whole number of at least 1, got: %q", key, v)
+	}
+
+	t := int32(threshold)
+	return &t, nil
+}
+
+// MakeProbes returns the liveness and readiness probes, and the startup probe when the
+// function asked for one. By default the health check runs `cat /tmp/.lock` every ten
+// seconds, the probe annotations of the function override the provider's defaults.
 func (f *FunctionFactory) MakeProbes(r types.FunctionDeployment) (*FunctionProbes, error) {
+	spec, err := ReadProbeSpec(r)
+	if err != nil {
+		return nil, err
+	}
+
+	probeType := spec.Type
+	if probeType == "" {
+		probeType = probeTypeExec
+		// a port can only be checked over the network, so it implies a http probe
+		if f.Config.HTTPProbe || spec.Port != 0 {
+			probeType = probeTypeHTTP
+		}
+	}
+
+	port := intstr.IntOrString{
+		Type:   intstr.Int,
+		IntVal: int32(f.Config.RuntimeHTTPPort),
+	}
+	if spec.Port != 0 {
+		port.IntVal = spec.Port
+	}
+
 	var handler corev1.ProbeHandler
 
-	if f.Config.HTTPProbe {
+	switch probeType {
+	case probeTypeHTTP:
+		path := "/_/health"
+		if spec.Path != "" {
+			path = spec.Path
+		}
 		handler = corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
-				Path: "/_/health",
-				Port: intstr.IntOrString{
-					Type:   intstr.Int,
-					IntVal: int32(f.Config.RuntimeHTTPPort),
-				},
+				Path: path,
+				Port: port,
+			},
+		}
+	case probeTypeTCP:
+		handler = corev1.ProbeHandler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: port,
 			},
 		}
-	} else {
+	default:
 		path := filepath.Join("/tmp/", ".lock")
+		if spec.Path != "" {
+			path = spec.Path
+		}
 		handler = corev1.ProbeHandler{
 			Exec: &corev1.ExecAction{
 				Command: []string{"cat", path},
@@ -46,8 +268,8 @@ func (f *FunctionFactory) MakeProbes(r types.FunctionDeployment) (*FunctionProbe
 		InitialDelaySeconds: f.Config.ReadinessProbe.InitialDelaySeconds,
 		TimeoutSeconds:      int32(f.Config.ReadinessProbe.TimeoutSeconds),
 		PeriodSeconds:       int32(f.Config.ReadinessProbe.PeriodSeconds),
-		SuccessThreshold:    1,
-		FailureThreshold:    3,
+		SuccessThreshold:    probeThreshold(f.Config.ReadinessProbe.SuccessThreshold, 1),
+		FailureThreshold:    probeThreshold(f.Config.ReadinessProbe.FailureThreshold, defaultProbeFailureThreshold),
 	}
 
 	probes.Liveness = &corev1.Probe{
@@ -56,8 +278,47 @@ func (f *FunctionFactory) MakeProbes(r types.FunctionDeployment) (*FunctionProbe
 		TimeoutSeconds:      int32(f.Config.LivenessProbe.TimeoutSeconds),
 		PeriodSeconds:       int32(f.Config.LivenessProbe.PeriodSeconds),
 		SuccessThreshold:    1,
-		FailureThreshold:    3,
+		FailureThreshold:    probeThreshold(f.Config.LivenessProbe.FailureThreshold, defaultProbeFailureThreshold),
+	}
+
+	for _, probe := range []*corev1.Probe{probes.Readiness, probes.Liveness} {
+		if spec.InitialDelaySeconds != nil {
+			probe.InitialDelaySeconds = *spec.InitialDelaySeconds
+		}
+		if spec.PeriodSeconds != nil {
+			probe.PeriodSeconds = *spec.PeriodSeconds
+		}
+		if spec.TimeoutSeconds != nil {
+			probe.TimeoutSeconds = *spec.TimeoutSeconds
+		}
+		if spec.FailureThreshold != nil {
+			probe.FailureThreshold = *spec.FailureThreshold
+		}
+	}
+
+	if spec.Startup {
+		probes.Startup = &corev1.Probe{
+			ProbeHandler:     handler,
+			TimeoutSeconds:   probes.Liveness.TimeoutSeconds,
+			PeriodSeconds:    defaultStartupPeriodSeconds,
+			SuccessThreshold: 1,
+			FailureThreshold: defaultStartupFailureThreshold,
+		}
+		if spec.StartupPeriodSeconds != nil {
+			probes.Startup.PeriodSeconds = *spec.StartupPeriodSeconds
+		}
+		if spec.StartupFailureThreshold != nil {
+			probes.Startup.FailureThreshold = *spec.StartupFailureThreshold
+		}
 	}
 
 	return &probes, nil
 }
+
+// probeThreshold returns the configured threshold, or the fallback when it is not set
+func probeThreshold(configured, fallback int32) int32 {
+	if configured > 0 {
+		return configured
+	}
+	return fallback
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func Test_makeProbes_useExec(t *testing.T) {
@@ -100,3 +101,129 @@ func Test_makeProbes_useCustomDurationHTTPProbe(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_makeProbes_annotationOverrides(t *testing.T) {
+	f := mockFactory()
+
+	request := types.FunctionDeployment{
+		Service: "testfunc",
+		Annotations: &map[string]string{
+			ProbeTypeAnnotation:             "http",
+			ProbePathAnnotation:             "/healthz",
+			ProbePortAnnotation:             "9000",
+			ProbeInitialDelayAnnotation:     "5s",
+			ProbePeriodAnnotation:           "15s",
+			ProbeTimeoutAnnotation:          "2s",
+			ProbeFailureThresholdAnnotation: "5",
+		},
+	}
+
+	probes, err := f.MakeProbes(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, probe := range map[string]*corev1.Probe{"readiness": probes.Readiness, "liveness": probes.Liveness} {
+		if probe.HTTPGet == nil {
+			t.Fatalf("%s probe should have had HTTPGet handler", name)
+		}
+		if probe.HTTPGet.Path != "/healthz" {
+			t.Errorf("%s probe want path /healthz, got %s", name, probe.HTTPGet.Path)
+		}
+		if probe.HTTPGet.Port.IntVal != 9000 {
+			t.Errorf("%s probe want port 9000, got %d", name, probe.HTTPGet.Port.IntVal)
+		}
+		if probe.InitialDelaySeconds != 5 || probe.PeriodSeconds != 15 || probe.TimeoutSeconds != 2 || probe.FailureThreshold != 5 {
+			t.Errorf("%s probe want delay 5, period 15, timeout 2, threshold 5, got %d, %d, %d, %d", name,
+				probe.InitialDelaySeconds, probe.PeriodSeconds, probe.TimeoutSeconds, probe.FailureThreshold)
+		}
+	}
+
+	if probes.Startup != nil {
+		t.Errorf("Startup probe should only be set when requested")
+	}
+}
+
+func Test_makeProbes_tcpWithStartup(t *testing.T) {
+	f := mockFactory()
+
+	request := types.FunctionDeployment{
+		Service: "testfunc",
+		Annotations: &map[string]string{
+			ProbeTypeAnnotation:                    "tcp",
+			StartupProbeAnnotation:                 "true",
+			StartupProbeFailureThresholdAnnotation: "60",
+		},
+	}
+
+	probes, err := f.MakeProbes(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if probes.Liveness.TCPSocket == nil || probes.Liveness.TCPSocket.Port.IntVal != f.Config.RuntimeHTTPPort {
+		t.Errorf("Liveness probe should have had TCPSocket handler on the runtime port")
+	}
+	if probes.Startup == nil || probes.Startup.TCPSocket == nil {
+		t.Fatalf("Startup probe should have had TCPSocket handler")
+	}
+	if probes.Startup.FailureThreshold != 60 {
+		t.Errorf("Startup probe want failure threshold 60, got %d", probes.Startup.FailureThreshold)
+	}
+	if probes.Startup.PeriodSeconds != defaultStartupPeriodSeconds {
+		t.Errorf("Startup probe want period %d, got %d", defaultStartupPeriodSeconds, probes.Startup.PeriodSeconds)
+	}
+}
+
+func Test_makeProbes_portImpliesHTTP(t *testing.T) {
+	f := mockFactory()
+
+	request := types.FunctionDeployment{
+		Service: "testfunc",
+		Annotations: &map[string]string{
+			ProbePortAnnotation: "9090",
+			ProbePathAnnotation: "/ready",
+		},
+	}
+
+	probes, err := f.MakeProbes(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := probes.Readiness.HTTPGet
+	if get == nil {
+		t.Fatalf("Readiness probe should have had HTTPGet handler when a port is set")
+	}
+	if get.Port.IntVal != 9090 || get.Path != "/ready" {
+		t.Errorf("want HTTPGet of /ready on 9090, got %s on %d", get.Path, get.Port.IntVal)
+	}
+}
+
+func Test_ReadProbeSpec_invalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{"unknown type", map[string]string{ProbeTypeAnnotation: "grpc"}},
+		{"relative path", map[string]string{ProbePathAnnotation: "healthz"}},
+		{"port out of range", map[string]string{ProbePortAnnotation: "70000"}},
+		{"period without unit", map[string]string{ProbePeriodAnnotation: "10"}},
+		{"fractional timeout", map[string]string{ProbeTimeoutAnnotation: "1500ms"}},
+		{"zero period", map[string]string{ProbePeriodAnnotation: "0s"}},
+		{"zero threshold", map[string]string{ProbeFailureThresholdAnnotation: "0"}},
+		{"path with tcp", map[string]string{ProbeTypeAnnotation: "tcp", ProbePathAnnotation: "/healthz"}},
+		{"port with exec", map[string]string{ProbeTypeAnnotation: "exec", ProbePortAnnotation: "8080"}},
+		{"startup settings without startup", map[string]string{StartupProbePeriodAnnotation: "5s"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			annotations := tc.annotations
+			_, err := ReadProbeSpec(types.FunctionDeployment{Service: "testfunc", Annotations: &annotations})
+			if err == nil {
+				t.Fatalf("want error for annotations %v", tc.annotations)
+			}
+		})
+	}
+}
@@ -16,13 +16,13 @@ import (
 	corelister "k8s.io/client-go/listers/core/v1"
 )
 
-// watchdogPort for the OpenFaaS function watchdog
-const watchdogPort = 8080
-
-func NewFunctionLookup(ns string, lister corelister.EndpointsLister) *FunctionLookup {
+// NewFunctionLookup creates a FunctionLookup, port is used for Endpoints
+// which do not list the port of the function's watchdog
+func NewFunctionLookup(ns string, lister corelister.EndpointsLister, port int32) *FunctionLookup {
 	return &FunctionLookup{
 		DefaultNamespace: ns,
 		EndpointLister:   lister,
+		Port:             port,
 		Listers:          map[string]corelister.EndpointsNamespaceLister{},
 		lock:             sync.RWMutex{},
 	}
@@ -32,6 +32,7 @@ type FunctionLookup struct {
 	DefaultNamespace string
 	EndpointLister   corelister.EndpointsLister
 	Listers          map[string]corelister.EndpointsNamespaceLister
+	Port             int32
 
 	lock sync.RWMutex
 }
@@ -57,9 +58,16 @@ func getNamespace(name, defaultNamespace string) string {
 }
 
 func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
+	return l.ResolveExcluding(name, nil)
+}
+
+// ResolveExcluding works like Resolve, but will avoid any endpoints given in exclude
+// when another address is available. This is used by the proxy to try a different
+// replica when retrying a failed invocation.
+func (l *FunctionLookup) ResolveExcluding(name string, exclude []url.URL) (url.URL, error) {
 	functionName := name
 	namespace := getNamespace(name, l.DefaultNamespace)
-	if err := l.verifyNamespace(namespace); err != nil {
+	if err := verifyNamespace(namespace); err != nil {
 		return url.URL{}, err
 	}
 
@@ -84,16 +92,37 @@ func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
 		return url.URL{}, fmt.Errorf("no subsets available for \"%s.%s\"", functionName, namespace)
 	}
 
-	all := len(svc.Subsets[0].Addresses)
 	if len(svc.Subsets[0].Addresses) == 0 {
 		return url.URL{}, fmt.Errorf("no addresses in subset for \"%s.%s\"", functionName, namespace)
 	}
 
-	target := rand.Intn(all)
+	candidates := []string{}
+	for _, address := range svc.Subsets[0].Addresses {
+		if !isExcluded(address.IP, exclude) {
+			candidates = append(candidates, address.IP)
+		}
+	}
+
+	// fall back to all addresses when every one of them has been excluded
+	if len(candidates) == 0 {
+		for _, address := range svc.Subsets[0].Addresses {
+			candidates = append(candidates, address.IP)
+		}
+	}
+
+	target := rand.Intn(len(candidates))
+
+	serviceIP := candidates[target]
 
-	serviceIP := svc.Subsets[0].Addresses[target].IP
+	port := l.Port
+	for _, p := range svc.Subsets[0].Ports {
+		if p.Name == "http" || len(svc.Subsets[0].Ports) == 1 {
+			port = p.Port
+			break
+		}
+	}
 
-	urlStr := fmt.Sprintf("http://%s:%d", serviceIP, watchdogPort)
+	urlStr := fmt.Sprintf("http://%s:%d", serviceIP, port)
 
 	urlRes, err := url.Parse(urlStr)
 	if err != nil {
@@ -103,7 +132,17 @@ func (l *FunctionLookup) Resolve(name string) (url.URL, error) {
 	return *urlRes, nil
 }
 
-func (l *FunctionLookup) verifyNamespace(name string) error {
+// isExcluded returns true when ip matches the hostname of any of the excluded URLs
+func isExcluded(ip string, exclude []url.URL) bool {
+	for _, u := range exclude {
+		if u.Hostname() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyNamespace(name string) error {
 	if name != "kube-system" {
 		return nil
 	}
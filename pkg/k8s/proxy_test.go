@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -50,7 +51,7 @@ func Test_FunctionLookup(t *testing.T) {
 
 	lister := FakeLister{}
 
-	resolver := NewFunctionLookup("testDefault", lister)
+	resolver := NewFunctionLookup("testDefault", lister, 8080)
 
 	cases := []struct {
 		name     string
@@ -92,3 +93,81 @@ func Test_FunctionLookup(t *testing.T) {
 		})
 	}
 }
+
+type multiAddressNSLister struct {
+	FakeNSLister
+}
+
+func (f multiAddressNSLister) Get(name string) (*corev1.Endpoints, error) {
+	ep := corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+		}},
+	}
+
+	return &ep, nil
+}
+
+func Test_FunctionLookup_ResolveExcluding(t *testing.T) {
+	resolver := NewFunctionLookup("testDefault", FakeLister{}, 8080)
+	resolver.SetLister("testDefault", multiAddressNSLister{})
+
+	excluded, _ := url.Parse("http://10.0.0.1:8080")
+
+	for i := 0; i < 10; i++ {
+		got, err := resolver.ResolveExcluding("testfunc", []url.URL{*excluded})
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		if got.String() != "http://10.0.0.2:8080" {
+			t.Fatalf("expected excluded address to be skipped, got %s", got.String())
+		}
+	}
+
+	all := []url.URL{*excluded}
+	other, _ := url.Parse("http://10.0.0.2:8080")
+	all = append(all, *other)
+
+	if _, err := resolver.ResolveExcluding("testfunc", all); err != nil {
+		t.Fatalf("expected an address when all are excluded, got %s", err)
+	}
+}
+
+type portNSLister struct {
+	FakeNSLister
+}
+
+func (f portNSLister) Get(name string) (*corev1.Endpoints, error) {
+	ep := corev1.Endpoints{
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []corev1.EndpointPort{{Name: "http", Port: 8000}},
+		}},
+	}
+
+	return &ep, nil
+}
+
+func Test_FunctionLookup_RuntimePort(t *testing.T) {
+	resolver := NewFunctionLookup("testDefault", FakeLister{}, 8000)
+
+	got, err := resolver.Resolve("testfunc")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got.String() != "http://127.0.0.1:8000" {
+		t.Fatalf("expected the configured port when Endpoints have no ports, got %s", got.String())
+	}
+
+	resolver = NewFunctionLookup("testDefault", FakeLister{}, 8080)
+	resolver.SetLister("testDefault", portNSLister{})
+
+	got, err = resolver.Resolve("testfunc")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if got.String() != "http://10.0.0.1:8000" {
+		t.Fatalf("expected the port of the Endpoints, got %s", got.String())
+	}
+}
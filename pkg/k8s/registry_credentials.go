@@ -0,0 +1,345 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultRegistryServer is used when no server is given, and is the server name
+	// expected by the container runtime for the Docker Hub
+	defaultRegistryServer = "https://index.docker.io/v1/"
+
+	// defaultServiceAccount is the service account used by functions without one set
+	defaultServiceAccount = "default"
+
+	// registryCredentialsLabel marks the secrets created by RegistryCredentialsClient, which
+	// are left out of the secrets API
+	registryCredentialsLabel = "com.openfaas.registry-credentials"
+)
+
+// RegistryCredential is a request to create or replace the credentials for a registry
+type RegistryCredential struct {
+	// Name of the secret holding the credentials
+	Name string `json:"name"`
+
+	// Namespace of the secret
+	Namespace string `json:"namespace,omitempty"`
+
+	// Server is the registry, i.e. ghcr.io, and defaults to the Docker Hub
+	Server string `json:"server"`
+
+	// Username for the registry
+	Username string `json:"username"`
+
+	// Password or access token for the registry
+	Password string `json:"password"`
+
+	// Email is optional and only used by some registries
+	Email string `json:"email,omitempty"`
+
+	// DefaultServiceAccount adds the credentials to the image pull secrets of the
+	// namespace's default service account, so that every function can pull with them
+	DefaultServiceAccount bool `json:"defaultServiceAccount"`
+}
+
+// RegistryCredentialMetadata describes registry credentials without revealing them
+type RegistryCredentialMetadata struct {
+	// Name of the secret holding the credentials
+	Name string `json:"name"`
+
+	// Namespace of the secret
+	Namespace string `json:"namespace"`
+
+	// Registries which the secret holds credentials for
+	Registries []string `json:"registries"`
+
+	// DefaultServiceAccount is true when the credentials are used by the namespace's
+	// default service account
+	DefaultServiceAccount bool `json:"defaultServiceAccount"`
+
+	// CreatedAt is when the secret was created
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RegistryCredentialsClient manages kubernetes.io/dockerconfigjson secrets, which
+// ConfigureSecrets adds to the image pull secrets of the functions which use them
+type RegistryCredentialsClient interface {
+	// List returns the registry credentials in the namespace
+	List(namespace string) ([]RegistryCredentialMetadata, error)
+	// Create adds registry credentials
+	Create(credential RegistryCredential) error
+	// Replace updates existing registry credentials
+	Replace(credential RegistryCredential) error
+	// Delete removes registry credentials, and removes them from the default service account
+	Delete(namespace, name string) error
+}
+
+type registryCredentialsClient struct {
+	kube kubernetes.Interface
+}
+
+// NewRegistryCredentialsClient constructs a RegistryCredentialsClient
+func NewRegistryCredentialsClient(kube kubernetes.Interface) RegistryCredentialsClient {
+	return &registryCredentialsClient{kube: kube}
+}
+
+// dockerConfigJSON is the format of the .dockerconfigjson key
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+func (c registryCredentialsClient) List(namespace string) ([]RegistryCredentialMetadata, error) {
+	res, err := c.kube.CoreV1().Secrets(namespace).List(context.TODO(), secretClient{}.selector())
+	if err != nil {
+		log.Printf("failed to list registry credentials in %s: %v\n", namespace, err)
+		return nil, err
+	}
+
+	attached, err := c.attached(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []RegistryCredentialMetadata{}
+	for _, item := range res.Items {
+		if item.Type != apiv1.SecretTypeDockerConfigJson {
+			continue
+		}
+
+		registries := []string{}
+		config := dockerConfigJSON{}
+		if err := json.Unmarshal(item.Data[apiv1.DockerConfigJsonKey], &config); err != nil {
+			log.Printf("unable to parse registry credentials %s.%s: %v\n", item.Name, namespace, err)
+		}
+		for server := range config.Auths {
+			registries = append(registries, server)
+		}
+		sort.Strings(registries)
+
+		credentials = append(credentials, RegistryCredentialMetadata{
+			Name:                  item.Name,
+			Namespace:             item.Namespace,
+			Registries:            registries,
+			DefaultServiceAccount: attached[item.Name],
+			CreatedAt:             item.CreationTimestamp.Time,
+		})
+	}
+
+	return credentials, nil
+}
+
+func (c registryCredentialsClient) Create(credential RegistryCredential) error {
+	secret, err := newRegistrySecret(credential)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.kube.CoreV1().Secrets(credential.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil {
+		log.Printf("failed to create registry credentials %s.%s: %v\n", credential.Name, credential.Namespace, err)
+		return err
+	}
+
+	log.Printf("created registry credentials %s.%s for %s\n", credential.Name, credential.Namespace, registryServer(credential.Server))
+
+	if err := c.setDefaultServiceAccount(credential.Namespace, credential.Name, credential.DefaultServiceAccount); err != nil {
+		// remove the secret, so that the request can be retried
+		if deleteErr := c.kube.CoreV1().Secrets(credential.Namespace).Delete(context.TODO(), credential.Name, metav1.DeleteOptions{}); deleteErr != nil {
+			log.Printf("can not remove registry credentials %s.%s: %v\n", credential.Name, credential.Namespace, deleteErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c registryCredentialsClient) Replace(credential RegistryCredential) error {
+	secret, err := newRegistrySecret(credential)
+	if err != nil {
+		return err
+	}
+
+	secrets := c.kube.CoreV1().Secrets(credential.Namespace)
+	found, err := secrets.Get(context.TODO(), credential.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("can not retrieve registry credentials for update %s.%s: %v\n", credential.Name, credential.Namespace, err)
+		return err
+	}
+
+	if found.Type != apiv1.SecretTypeDockerConfigJson {
+		return k8serrors.NewBadRequest(fmt.Sprintf("secret %s is not a registry credential", credential.Name))
+	}
+
+	found.Data = secret.Data
+	if found.Labels == nil {
+		found.Labels = map[string]string{}
+	}
+	found.Labels[registryCredentialsLabel] = "true"
+	if _, err := secrets.Update(context.TODO(), found, metav1.UpdateOptions{}); err != nil {
+		log.Printf("can not update registry credentials %s.%s: %v\n", credential.Name, credential.Namespace, err)
+		return err
+	}
+
+	return c.setDefaultServiceAccount(credential.Namespace, credential.Name, credential.DefaultServiceAccount)
+}
+
+func (c registryCredentialsClient) Delete(namespace, name string) error {
+	secrets := c.kube.CoreV1().Secrets(namespace)
+	found, err := secrets.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if found.Type != apiv1.SecretTypeDockerConfigJson {
+		return k8serrors.NewBadRequest(fmt.Sprintf("secret %s is not a registry credential", name))
+	}
+
+	if err := c.setDefaultServiceAccount(namespace, name, false); err != nil {
+		return err
+	}
+
+	if err := secrets.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
+		log.Printf("can not delete registry credentials %s.%s: %v\n", name, namespace, err)
+		return err
+	}
+
+	return nil
+}
+
+// attached returns the image pull secrets of the default service account
+func (c registryCredentialsClient) attached(namespace string) (map[string]bool, error) {
+	attached := map[string]bool{}
+
+	sa, err := c.kube.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), defaultServiceAccount, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return attached, nil
+		}
+		return nil, err
+	}
+
+	for _, ref := range sa.ImagePullSecrets {
+		attached[ref.Name] = true
+	}
+	return attached, nil
+}
+
+// setDefaultServiceAccount adds or removes the secret from the image pull secrets of the
+// default service account, the service account is only updated when it changes
+func (c registryCredentialsClient) setDefaultServiceAccount(namespace, name string, attach bool) error {
+	accounts := c.kube.CoreV1().ServiceAccounts(namespace)
+	sa, err := accounts.Get(context.TODO(), defaultServiceAccount, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) && !attach {
+			return nil
+		}
+		log.Printf("can not retrieve service account %s.%s: %v\n", defaultServiceAccount, namespace, err)
+		return err
+	}
+
+	refs := []apiv1.LocalObjectReference{}
+	found := false
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name == name {
+			found = true
+			if !attach {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	if found == attach {
+		return nil
+	}
+
+	if attach {
+		refs = append(refs, apiv1.LocalObjectReference{Name: name})
+	}
+	sa.ImagePullSecrets = refs
+
+	if _, err := accounts.Update(context.TODO(), sa, metav1.UpdateOptions{}); err != nil {
+		log.Printf("can not update service account %s.%s: %v\n", defaultServiceAccount, namespace, err)
+		return err
+	}
+
+	return nil
+}
+
+func newRegistrySecret(credential RegistryCredential) (*apiv1.Secret, error) {
+	if strings.TrimSpace(credential.Namespace) == "" {
+		return nil, k8serrors.NewBadRequest("namespace may not be empty")
+	}
+
+	if errs := validation.IsDNS1123Subdomain(credential.Name); len(errs) > 0 {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("invalid name %q: %s", credential.Name, strings.Join(errs, ", ")))
+	}
+
+	if credential.Username == "" || credential.Password == "" {
+		return nil, k8serrors.NewBadRequest("username and password are required")
+	}
+
+	server := registryServer(credential.Server)
+	config := dockerConfigJSON{
+		Auths: map[string]dockerConfigEntry{
+			server: {
+				Username: credential.Username,
+				Password: credential.Password,
+				Email:    credential.Email,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Password)),
+			},
+		},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.Secret{
+		Type: apiv1.SecretTypeDockerConfigJson,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      credential.Name,
+			Namespace: credential.Namespace,
+			Labels: map[string]string{
+				secretLabel:              secretLabelValue,
+				registryCredentialsLabel: "true",
+			},
+		},
+		Data: map[string][]byte{
+			apiv1.DockerConfigJsonKey: data,
+		},
+	}, nil
+}
+
+func registryServer(server string) string {
+	switch strings.TrimSpace(server) {
+	case "", "docker.io", "index.docker.io":
+		return defaultRegistryServer
+	default:
+		return strings.TrimSpace(server)
+	}
+}
@@ -0,0 +1,196 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_RegistryCredentialsClient(t *testing.T) {
+	namespace := "openfaas-fn"
+	kube := fake.NewSimpleClientset(&apiv1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: namespace},
+		ImagePullSecrets: []apiv1.LocalObjectReference{{Name: "existing"}},
+	})
+	client := NewRegistryCredentialsClient(kube)
+
+	err := client.Create(RegistryCredential{
+		Name:                  "ghcr",
+		Namespace:             namespace,
+		Server:                "ghcr.io",
+		Username:              "alex",
+		Password:              "token",
+		DefaultServiceAccount: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	secret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "ghcr", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if secret.Type != apiv1.SecretTypeDockerConfigJson {
+		t.Fatalf("want type %s, got %s", apiv1.SecretTypeDockerConfigJson, secret.Type)
+	}
+
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[apiv1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := config.Auths["ghcr.io"].Auth; got != "YWxleDp0b2tlbg==" {
+		t.Fatalf("want auth for alex:token, got %q", got)
+	}
+
+	assertPullSecrets(t, kube, namespace, []string{"existing", "ghcr"})
+
+	credentials, err := client.List(namespace)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(credentials) != 1 || !reflect.DeepEqual(credentials[0].Registries, []string{"ghcr.io"}) || !credentials[0].DefaultServiceAccount {
+		t.Fatalf("want ghcr.io attached to the default service account, got %+v", credentials)
+	}
+
+	err = client.Replace(RegistryCredential{Name: "ghcr", Namespace: namespace, Server: "ghcr.io", Username: "alex", Password: "token2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertPullSecrets(t, kube, namespace, []string{"existing"})
+
+	if err := client.Delete(namespace, "ghcr"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "ghcr", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want secret to be deleted, got %v", err)
+	}
+}
+
+func Test_RegistryCredentialsClient_Validation(t *testing.T) {
+	client := NewRegistryCredentialsClient(fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "openfaas-fn"},
+		Type:       apiv1.SecretTypeOpaque,
+	}))
+
+	err := client.Create(RegistryCredential{Name: "hub", Namespace: "openfaas-fn", Username: "alex"})
+	if !k8serrors.IsBadRequest(err) {
+		t.Fatalf("want bad request without a password, got %v", err)
+	}
+
+	if err := client.Delete("openfaas-fn", "api-key"); !k8serrors.IsBadRequest(err) {
+		t.Fatalf("want bad request deleting an opaque secret, got %v", err)
+	}
+}
+
+func Test_RegistryCredentialsClient_CreateRollsBack(t *testing.T) {
+	namespace := "openfaas-fn"
+
+	// without a default service account, the credentials can not be attached to it
+	kube := fake.NewSimpleClientset()
+	client := NewRegistryCredentialsClient(kube)
+
+	credential := RegistryCredential{
+		Name:                  "ghcr",
+		Namespace:             namespace,
+		Server:                "ghcr.io",
+		Username:              "alex",
+		Password:              "token",
+		DefaultServiceAccount: true,
+	}
+	if err := client.Create(credential); err == nil {
+		t.Fatal("want error when the default service account does not exist")
+	}
+
+	if _, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), "ghcr", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want secret to be removed after the failure, got %v", err)
+	}
+
+	kube.CoreV1().ServiceAccounts(namespace).Create(context.TODO(), &apiv1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: namespace},
+	}, metav1.CreateOptions{})
+
+	if err := client.Create(credential); err != nil {
+		t.Fatalf("want retry to succeed, got %s", err)
+	}
+	assertPullSecrets(t, kube, namespace, []string{"ghcr"})
+}
+
+func Test_SecretsClient_ListExcludesRegistryCredentials(t *testing.T) {
+	namespace := "openfaas-fn"
+	kube := fake.NewSimpleClientset()
+
+	if err := NewRegistryCredentialsClient(kube).Create(RegistryCredential{
+		Name: "ghcr", Namespace: namespace, Server: "ghcr.io", Username: "alex", Password: "token",
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	secrets := NewSecretsClient(kube)
+	if err := secrets.Create(Secret{Secret: types.Secret{Name: "api-key", Namespace: namespace, Value: "secret"}}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// registry credentials created outside of the API are still listed, with their type
+	kube.CoreV1().Secrets(namespace).Create(context.TODO(), &apiv1.Secret{
+		Type: apiv1.SecretTypeDockerConfigJson,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "quay",
+			Namespace: namespace,
+			Labels:    map[string]string{secretLabel: secretLabelValue},
+		},
+		Data: map[string][]byte{apiv1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+	}, metav1.CreateOptions{})
+
+	listed, err := secrets.List(namespace)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	kinds := map[string]string{}
+	for _, secret := range listed {
+		kinds[secret.Name] = secret.Type
+	}
+
+	want := map[string]string{
+		"api-key": string(apiv1.SecretTypeOpaque),
+		"quay":    string(apiv1.SecretTypeDockerConfigJson),
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("want %v, got %v", want, kinds)
+	}
+}
+
+func Test_registryServer_DefaultsToDockerHub(t *testing.T) {
+	for _, server := range []string{"", "docker.io", "index.docker.io"} {
+		if got := registryServer(server); got != defaultRegistryServer {
+			t.Errorf("server %q, want %q, got %q", server, defaultRegistryServer, got)
+		}
+	}
+}
+
+func assertPullSecrets(t *testing.T, kube *fake.Clientset, namespace string, want []string) {
+	t.Helper()
+
+	sa, err := kube.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), "default", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := []string{}
+	for _, ref := range sa.ImagePullSecrets {
+		got = append(got, ref.Name)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want image pull secrets %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,156 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RegistryKeychain returns the credentials which the function's Pods would pull its
+// image with: the image pull secrets among the function's secrets, followed by those of
+// its ServiceAccount. The secrets are only read when a registry is contacted, and
+// registries without credentials are accessed anonymously.
+func (f *FunctionFactory) RegistryKeychain(ctx context.Context, namespace string, request types.FunctionDeployment) authn.Keychain {
+	serviceAccount := defaultServiceAccount
+	if spec, err := ReadServiceAccountSpec(request); err == nil && spec.Name != "" {
+		serviceAccount = spec.Name
+	}
+
+	return &functionKeychain{
+		ctx:            ctx,
+		client:         f.Client,
+		namespace:      namespace,
+		secrets:        request.Secrets,
+		serviceAccount: serviceAccount,
+	}
+}
+
+// functionKeychain is an authn.Keychain backed by image pull secrets
+type functionKeychain struct {
+	ctx            context.Context
+	client         kubernetes.Interface
+	namespace      string
+	secrets        []string
+	serviceAccount string
+
+	once  sync.Once
+	auths map[string]authn.AuthConfig
+	err   error
+}
+
+// Resolve returns the credentials for the registry of the resource
+func (k *functionKeychain) Resolve(resource authn.Resource) (authn.Authenticator, error) {
+	k.once.Do(func() {
+		k.auths, k.err = k.load()
+	})
+	if k.err != nil {
+		return nil, k.err
+	}
+
+	if auth, ok := k.auths[normaliseRegistry(resource.RegistryStr())]; ok {
+		return authn.FromConfig(auth), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+// load reads the registry credentials, the first secret with credentials for a
+// registry is used as the kubelet does
+func (k *functionKeychain) load() (map[string]authn.AuthConfig, error) {
+	names := []string{}
+	names = append(names, k.secrets...)
+
+	// the ServiceAccount may be created along with the function, in which case it has no
+	// image pull secrets yet
+	sa, err := k.client.CoreV1().ServiceAccounts(k.namespace).Get(k.ctx, k.serviceAccount, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to read ServiceAccount %s: %s", k.serviceAccount, err.Error())
+	}
+	if err == nil {
+		for _, ref := range sa.ImagePullSecrets {
+			names = append(names, ref.Name)
+		}
+	}
+
+	auths := map[string]authn.AuthConfig{}
+	for _, secretName := range names {
+		secret, err := k.client.CoreV1().Secrets(k.namespace).Get(k.ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to read image pull secret %s: %s", secretName, err.Error())
+		}
+
+		entries, err := readDockerConfig(secret)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse image pull secret %s: %s", secretName, err.Error())
+		}
+
+		for server, entry := range entries {
+			registry := normaliseRegistry(server)
+			if _, ok := auths[registry]; ok {
+				continue
+			}
+			auths[registry] = authn.AuthConfig{
+				Username: entry.Username,
+				Password: entry.Password,
+				Auth:     entry.Auth,
+			}
+		}
+	}
+
+	return auths, nil
+}
+
+// readDockerConfig returns the entries of a kubernetes.io/dockerconfigjson or
+// kubernetes.io/dockercfg secret, other types of secret have none
+func readDockerConfig(secret *apiv1.Secret) (map[string]dockerConfigEntry, error) {
+	switch secret.Type {
+	case apiv1.SecretTypeDockerConfigJson:
+		config := dockerConfigJSON{}
+		if err := json.Unmarshal(secret.Data[apiv1.DockerConfigJsonKey], &config); err != nil {
+			return nil, err
+		}
+		return config.Auths, nil
+	case apiv1.SecretTypeDockercfg:
+		entries := map[string]dockerConfigEntry{}
+		if err := json.Unmarshal(secret.Data[apiv1.DockerConfigKey], &entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	default:
+		return nil, nil
+	}
+}
+
+// normaliseRegistry reduces a server from a docker config, such as
+// https://index.docker.io/v1/, to the registry host used in image references
+func normaliseRegistry(server string) string {
+	registry := strings.ToLower(strings.TrimSpace(server))
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+
+	switch registry {
+	case "docker.io", "registry-1.docker.io", name.DefaultRegistry:
+		return name.DefaultRegistry
+	}
+
+	return registry
+}
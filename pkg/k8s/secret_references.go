@@ -0,0 +1,83 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+)
+
+// FunctionSecretReferences finds the functions which reference each secret. The Deployment
+// lister is used for the default namespace, and the Kubernetes API for any other namespace
+// since the lister's informer is scoped to the default namespace.
+type FunctionSecretReferences struct {
+	defaultNamespace string
+	lister           v1.DeploymentLister
+	client           kubernetes.Interface
+}
+
+// NewFunctionSecretReferences creates a FunctionSecretReferences
+func NewFunctionSecretReferences(defaultNamespace string, lister v1.DeploymentLister, client kubernetes.Interface) *FunctionSecretReferences {
+	return &FunctionSecretReferences{
+		defaultNamespace: defaultNamespace,
+		lister:           lister,
+		client:           client,
+	}
+}
+
+// References returns the sorted names of the functions in the namespace which reference
+// each secret, keyed by the name of the secret
+func (r *FunctionSecretReferences) References(namespace string) (map[string][]string, error) {
+	deployments, err := r.functionDeployments(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	references := map[string][]string{}
+	for _, d := range deployments {
+		for _, secret := range ReadFunctionSecretsSpec(d) {
+			references[secret] = append(references[secret], d.Name)
+		}
+	}
+
+	for _, functions := range references {
+		sort.Strings(functions)
+	}
+
+	return references, nil
+}
+
+func (r *FunctionSecretReferences) functionDeployments(namespace string) ([]appsv1.Deployment, error) {
+	if namespace == r.defaultNamespace {
+		req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := r.lister.Deployments(namespace).List(labels.NewSelector().Add(*req))
+		if err != nil {
+			return nil, err
+		}
+
+		deployments := make([]appsv1.Deployment, 0, len(items))
+		for _, item := range items {
+			deployments = append(deployments, *item)
+		}
+		return deployments, nil
+	}
+
+	res, err := r.client.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "faas_function"})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Items, nil
+}
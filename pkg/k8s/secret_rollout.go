@@ -0,0 +1,281 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// SecretsChecksumAnnotation is set on the Pod template of a function to a hash of the
+	// contents of its secrets, so that changing a secret rolls the function's Pods
+	SecretsChecksumAnnotation = "com.openfaas.secrets.checksum"
+
+	// SecretsRolloutAnnotation opts a function out of rolling restarts when its secrets
+	// change, when set to "false"
+	SecretsRolloutAnnotation = "com.openfaas.secrets.rollout"
+
+	// secretRolloutResync is how often the enabled namespaces are checked, so that the
+	// secrets of newly enabled namespaces are watched
+	secretRolloutResync = time.Minute
+)
+
+// SecretRollout watches the secrets managed by OpenFaaS and restarts the functions which
+// reference a secret when its contents change, by patching SecretsChecksumAnnotation into
+// the function's Pod template. The secrets of every enabled namespace are watched with an
+// informer per namespace, which is started and stopped as namespaces are enabled and disabled.
+type SecretRollout struct {
+	client     kubernetes.Interface
+	namespaces func() []string
+	references *FunctionSecretReferences
+	resync     time.Duration
+
+	lock    sync.Mutex
+	secrets map[string]corelisters.SecretLister
+	stops   map[string]context.CancelFunc
+}
+
+// NewSecretRollout creates a SecretRollout for the OpenFaaS-managed secrets in the namespaces
+// returned by namespaces, which are listed again periodically
+func NewSecretRollout(client kubernetes.Interface, defaultNamespace string, namespaces func() []string, lister v1.DeploymentLister) *SecretRollout {
+	return &SecretRollout{
+		client:     client,
+		namespaces: namespaces,
+		references: NewFunctionSecretReferences(defaultNamespace, lister, client),
+		resync:     secretRolloutResync,
+		secrets:    map[string]corelisters.SecretLister{},
+		stops:      map[string]context.CancelFunc{},
+	}
+}
+
+// Run watches the secrets of the enabled namespaces and blocks until stopCh is closed
+func (r *SecretRollout) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(r.resync)
+	defer ticker.Stop()
+
+	for {
+		r.watchNamespaces(stopCh)
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchNamespaces starts an informer for each newly enabled namespace, and stops the
+// informers of namespaces which are no longer enabled
+func (r *SecretRollout) watchNamespaces(stopCh <-chan struct{}) {
+	enabled := map[string]bool{}
+	for _, namespace := range r.namespaces() {
+		enabled[namespace] = true
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for namespace, stop := range r.stops {
+		if !enabled[namespace] {
+			log.Printf("Stopping secret rollout for namespace: %s", namespace)
+			stop()
+			delete(r.stops, namespace)
+			delete(r.secrets, namespace)
+		}
+	}
+
+	for namespace := range enabled {
+		if _, ok := r.stops[namespace]; ok {
+			continue
+		}
+
+		ctx, stop := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-stopCh:
+				stop()
+			case <-ctx.Done():
+			}
+		}()
+
+		r.secrets[namespace] = r.startInformer(namespace, ctx.Done())
+		r.stops[namespace] = stop
+	}
+}
+
+// startInformer watches the OpenFaaS-managed secrets of the namespace until stopCh is closed
+func (r *SecretRollout) startInformer(namespace string, stopCh <-chan struct{}) corelisters.SecretLister {
+	factory := informers.NewSharedInformerFactoryWithOptions(r.client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = fmt.Sprintf("%s=%s", secretLabel, secretLabelValue)
+		}))
+
+	secrets := factory.Core().V1().Secrets()
+	secrets.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok := oldObj.(*corev1.Secret)
+			if !ok {
+				return
+			}
+			secret, ok := newObj.(*corev1.Secret)
+			if !ok {
+				return
+			}
+
+			if secretChecksum([]*corev1.Secret{old}) == secretChecksum([]*corev1.Secret{secret}) {
+				return
+			}
+
+			if err := r.rollout(context.Background(), secret.Namespace, secret.Name); err != nil {
+				log.Printf("Unable to roll functions for secret %s.%s: %s", secret.Name, secret.Namespace, err.Error())
+			}
+		},
+	})
+
+	log.Printf("Starting secret rollout for namespace: %s", namespace)
+	factory.Start(stopCh)
+
+	return secrets.Lister()
+}
+
+// rollout patches the checksum of the secrets of each function which references the
+// named secret, unless the function has opted out
+func (r *SecretRollout) rollout(ctx context.Context, namespace, name string) error {
+	deployments, err := r.references.functionDeployments(namespace)
+	if err != nil {
+		return err
+	}
+
+	for _, deployment := range deployments {
+		if !referencesSecret(deployment, name) || !rolloutEnabled(deployment) {
+			continue
+		}
+
+		checksum, err := r.functionChecksum(deployment)
+		if err != nil {
+			return err
+		}
+
+		if deployment.Spec.Template.Annotations[SecretsChecksumAnnotation] == checksum {
+			continue
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"annotations": map[string]string{
+							SecretsChecksumAnnotation: checksum,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = r.client.AppsV1().Deployments(namespace).Patch(ctx, deployment.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Rolling function %s.%s after secret %s changed", deployment.Name, namespace, name)
+	}
+
+	return nil
+}
+
+// functionChecksum hashes the contents of the OpenFaaS-managed secrets referenced by
+// the deployment, secrets which do not exist or are not managed are skipped
+func (r *SecretRollout) functionChecksum(deployment appsv1.Deployment) (string, error) {
+	r.lock.Lock()
+	lister, ok := r.secrets[deployment.Namespace]
+	r.lock.Unlock()
+	if !ok {
+		return "", fmt.Errorf("secrets of namespace %s are not watched", deployment.Namespace)
+	}
+
+	secrets := []*corev1.Secret{}
+	for _, name := range ReadFunctionSecretsSpec(deployment) {
+		secret, err := lister.Secrets(deployment.Namespace).Get(name)
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secretChecksum(secrets), nil
+}
+
+func referencesSecret(deployment appsv1.Deployment, name string) bool {
+	for _, secret := range ReadFunctionSecretsSpec(deployment) {
+		if secret == name {
+			return true
+		}
+	}
+	return false
+}
+
+func rolloutEnabled(deployment appsv1.Deployment) bool {
+	return deployment.Annotations[SecretsRolloutAnnotation] != "false"
+}
+
+// secretChecksum returns a SHA256 of the names and data of the secrets, independent of
+// the order of the secrets and their keys
+func secretChecksum(secrets []*corev1.Secret) string {
+	sorted := make([]*corev1.Secret, len(secrets))
+	copy(sorted, secrets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	h := sha256.New()
+	for _, secret := range sorted {
+		keys := make([]string, 0, len(secret.Data)+len(secret.StringData))
+		values := map[string][]byte{}
+		for k, v := range secret.Data {
+			keys = append(keys, k)
+			values[k] = v
+		}
+		for k, v := range secret.StringData {
+			if _, ok := values[k]; !ok {
+				keys = append(keys, k)
+			}
+			values[k] = []byte(v)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(h, "%s\x00", secret.Name)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s\x00%d\x00", k, len(values[k]))
+			h.Write(values[k])
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
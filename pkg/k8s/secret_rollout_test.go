@@ -0,0 +1,172 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_secretChecksum_IgnoresOrder(t *testing.T) {
+	a := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "a"},
+		Data:       map[string][]byte{"user": []byte("admin"), "password": []byte("secret")},
+	}
+	b := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "b"},
+		Data:       map[string][]byte{"token": []byte("abc")},
+	}
+
+	if secretChecksum([]*corev1.Secret{a, b}) != secretChecksum([]*corev1.Secret{b, a}) {
+		t.Fatal("want checksum to be independent of the order of the secrets")
+	}
+
+	changed := a.DeepCopy()
+	changed.Data["password"] = []byte("secret2")
+	if secretChecksum([]*corev1.Secret{a}) == secretChecksum([]*corev1.Secret{changed}) {
+		t.Fatal("want checksum to change when the data changes")
+	}
+}
+
+func Test_SecretRollout_rollout(t *testing.T) {
+	namespace := "openfaas-fn"
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: namespace},
+		Data:       map[string][]byte{"api-key": []byte("v2")},
+	}
+
+	figlet := newRolloutFunction(namespace, "figlet", "api-key")
+	optOut := newRolloutFunction(namespace, "nodeinfo", "api-key")
+	optOut.Annotations = map[string]string{SecretsRolloutAnnotation: "false"}
+	other := newRolloutFunction(namespace, "env", "db-password")
+
+	client := fake.NewSimpleClientset(figlet, optOut, other)
+
+	deployments := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, d := range []*appsv1.Deployment{figlet, optOut, other} {
+		deployments.Add(d)
+	}
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	secrets.Add(secret)
+
+	r := NewSecretRollout(client, namespace, func() []string { return []string{namespace} }, appslisters.NewDeploymentLister(deployments))
+	r.secrets[namespace] = corelisters.NewSecretLister(secrets)
+
+	if err := r.rollout(context.TODO(), namespace, "api-key"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := secretChecksum([]*corev1.Secret{secret})
+	got := getTemplateAnnotation(t, client, namespace, "figlet")
+	if got != want {
+		t.Fatalf("want checksum %q on figlet, got %q", want, got)
+	}
+
+	for _, name := range []string{"nodeinfo", "env"} {
+		if got := getTemplateAnnotation(t, client, namespace, name); got != "" {
+			t.Fatalf("want no checksum on %s, got %q", name, got)
+		}
+	}
+}
+
+func Test_SecretRollout_WatchesEnabledNamespaces(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-key",
+			Namespace: "team-a",
+			Labels:    map[string]string{secretLabel: secretLabelValue},
+		},
+		Data: map[string][]byte{"api-key": []byte("v1")},
+	}
+	client := fake.NewSimpleClientset(secret, newRolloutFunction("team-a", "figlet", "api-key"))
+
+	enabled := []string{"openfaas-fn", "team-a"}
+	deployments := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	r := NewSecretRollout(client, "openfaas-fn", func() []string { return enabled }, appslisters.NewDeploymentLister(deployments))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	r.watchNamespaces(stopCh)
+
+	if len(r.stops) != 2 {
+		t.Fatalf("want an informer for each enabled namespace, got: %d", len(r.stops))
+	}
+
+	// wait for the informer to list the secret, so that the update is seen as a change
+	for i := 0; i < 100; i++ {
+		if _, err := r.secrets["team-a"].Secrets("team-a").Get("api-key"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	updated := secret.DeepCopy()
+	updated.Data["api-key"] = []byte("v2")
+	if _, err := client.CoreV1().Secrets("team-a").Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := secretChecksum([]*corev1.Secret{updated})
+	got := ""
+	for i := 0; i < 100 && got != want; i++ {
+		time.Sleep(10 * time.Millisecond)
+		got = getTemplateAnnotation(t, client, "team-a", "figlet")
+	}
+	if got != want {
+		t.Fatalf("want checksum %q on figlet in team-a, got %q", want, got)
+	}
+
+	enabled = []string{"openfaas-fn"}
+	r.watchNamespaces(stopCh)
+
+	if _, ok := r.stops["team-a"]; ok || len(r.stops) != 1 {
+		t.Fatalf("want the informer of a disabled namespace to be stopped, got: %v", r.stops)
+	}
+}
+
+func newRolloutFunction(namespace, name, secret string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"faas_function": name},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{{
+						Name: name + "-projected-secrets",
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{{
+									Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: secret}},
+								}},
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func getTemplateAnnotation(t *testing.T, client *fake.Clientset, namespace, name string) string {
+	t.Helper()
+
+	deployment, err := client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return deployment.Spec.Template.Annotations[SecretsChecksumAnnotation]
+}
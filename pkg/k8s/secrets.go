@@ -9,12 +9,15 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	types "github.com/openfaas/faas-provider/types"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	typedV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
@@ -24,20 +27,81 @@ const (
 	secretLabel                  = "app.kubernetes.io/managed-by"
 	secretLabelValue             = "openfaas"
 	secretsProjectVolumeNameTmpl = "%s-projected-secrets"
+
+	// SecretsDirectoryAnnotation is a comma separated list of the function's secrets to project
+	// as a directory, with a file per key i.e. /var/openfaas/secrets/<secret>/<key>
+	SecretsDirectoryAnnotation = "com.openfaas.secrets.directory"
+
+	// SecretsEnvAnnotation is a comma separated list of secrets to expose as environment
+	// variables, in the form secret=ENV_VAR, or secret/key=ENV_VAR for a secret with several keys
+	SecretsEnvAnnotation = "com.openfaas.secrets.env"
 )
 
+// SecretMetadata describes a function secret without its values, so that it is safe
+// to return from the list API
+type SecretMetadata struct {
+	// Name of the secret
+	Name string `json:"name"`
+
+	// Namespace of the secret
+	Namespace string `json:"namespace"`
+
+	// Type of the Kubernetes secret, i.e. Opaque or kubernetes.io/dockerconfigjson for
+	// registry credentials
+	Type string `json:"type"`
+
+	// Keys present within the secret
+	Keys []string `json:"keys"`
+
+	// Labels of the secret
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// CreatedAt is when the secret was created
+	CreatedAt time.Time `json:"createdAt"`
+
+	// UpdatedAt is the time of the last change to the secret, or its creation time
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Functions are the names of the functions which reference the secret
+	Functions []string `json:"functions"`
+}
+
+// SecretEnvVar is an environment variable whose value is read from a key of a secret
+type SecretEnvVar struct {
+	// Secret is the name of the secret
+	Secret string
+
+	// Key within the secret, which defaults to the name of the secret
+	Key string
+
+	// Name of the environment variable
+	Name string
+}
+
+// Secret is a function secret. It extends the faas-provider Secret so that a secret can
+// hold several keys, such as a TLS certificate and its private key.
+type Secret struct {
+	types.Secret
+
+	// Data holds a text value for each key, it can not be combined with Value or RawValue
+	Data map[string]string `json:"data,omitempty"`
+
+	// RawData holds a binary value for each key, encoded as base64 in JSON
+	RawData map[string][]byte `json:"rawData,omitempty"`
+}
+
 // SecretsClient exposes the standardized CRUD behaviors for Kubernetes secrets.  These methods
 // will ensure that the secrets are structured and labelled correctly for use by the OpenFaaS system.
 type SecretsClient interface {
-	// List returns a list of available function secrets.  Only the names are returned
+	// List returns a list of available function secrets.  Only the metadata is returned
 	// to ensure we do not accidentally read or print the sensitive values during
 	// read operations.
-	List(namespace string) (names []string, err error)
+	List(namespace string) ([]SecretMetadata, error)
 	// Create adds a new secret, with the appropriate labels and structure to be
 	// used as a function secret.
-	Create(secret types.Secret) error
+	Create(secret Secret) error
 	// Replace updates the value of a function secret
-	Replace(secret types.Secret) error
+	Replace(secret Secret) error
 	// Delete removes a function secret
 	Delete(name string, namespace string) error
 	// GetSecrets queries Kubernetes for a list of secrets by name in the given k8s namespace.
@@ -58,6 +122,9 @@ type SecretInterfacer interface {
 
 type secretClient struct {
 	kube SecretInterfacer
+
+	// kek encrypts the values of secrets when set
+	kek KeyEncryptionKey
 }
 
 // NewSecretsClient constructs a new SecretsClient using the provided Kubernetes client.
@@ -67,27 +134,74 @@ func NewSecretsClient(kube kubernetes.Interface) SecretsClient {
 	}
 }
 
-func (c secretClient) List(namespace string) (names []string, err error) {
+// NewEncryptedSecretsClient constructs a SecretsClient which encrypts the values of the
+// secrets it creates and replaces with a data key wrapped by the kek
+func NewEncryptedSecretsClient(kube kubernetes.Interface, kek KeyEncryptionKey) SecretsClient {
+	return &secretClient{
+		kube: kube.CoreV1(),
+		kek:  kek,
+	}
+}
+
+func (c secretClient) List(namespace string) ([]SecretMetadata, error) {
 	res, err := c.kube.Secrets(namespace).List(context.TODO(), c.selector())
 	if err != nil {
 		log.Printf("failed to list secrets in %s: %v\n", namespace, err)
 		return nil, err
 	}
 
-	names = make([]string, len(res.Items))
-	for idx, item := range res.Items {
-		// this is safe because size of names matches res.Items exactly
-		names[idx] = item.Name
+	secrets := make([]SecretMetadata, 0, len(res.Items))
+	for _, item := range res.Items {
+		// registry credentials share the label, and are listed by RegistryCredentialsClient
+		if item.Labels[registryCredentialsLabel] == "true" {
+			continue
+		}
+
+		keys := make([]string, 0, len(item.Data))
+		for key := range item.Data {
+			if key != secretEnvelopeKey {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		secrets = append(secrets, SecretMetadata{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+			Type:      string(item.Type),
+			Keys:      keys,
+			Labels:    item.Labels,
+			CreatedAt: item.CreationTimestamp.Time,
+			UpdatedAt: lastUpdated(item.ObjectMeta),
+			Functions: []string{},
+		})
+	}
+	return secrets, nil
+}
+
+// lastUpdated returns the most recent time from the object's managed fields, which are
+// written on each create and update, or the creation time when there are none
+func lastUpdated(meta metav1.ObjectMeta) time.Time {
+	updated := meta.CreationTimestamp.Time
+	for _, field := range meta.ManagedFields {
+		if field.Time != nil && field.Time.After(updated) {
+			updated = field.Time.Time
+		}
 	}
-	return names, nil
+	return updated
 }
 
-func (c secretClient) Create(secret types.Secret) error {
+func (c secretClient) Create(secret Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
 	}
 
+	data, err := c.getValidSecretData(secret)
+	if err != nil {
+		return err
+	}
+
 	req := &apiv1.Secret{
 		Type: apiv1.SecretTypeOpaque,
 		ObjectMeta: metav1.ObjectMeta{
@@ -99,7 +213,9 @@ func (c secretClient) Create(secret types.Secret) error {
 		},
 	}
 
-	req.Data = c.getValidSecretData(secret)
+	if err := c.setData(req, data); err != nil {
+		return err
+	}
 
 	_, err = c.kube.Secrets(secret.Namespace).Create(context.TODO(), req, metav1.CreateOptions{})
 	if err != nil {
@@ -112,12 +228,17 @@ func (c secretClient) Create(secret types.Secret) error {
 	return nil
 }
 
-func (c secretClient) Replace(secret types.Secret) error {
+func (c secretClient) Replace(secret Secret) error {
 	err := c.validateSecret(secret)
 	if err != nil {
 		return err
 	}
 
+	data, err := c.getValidSecretData(secret)
+	if err != nil {
+		return err
+	}
+
 	kube := c.kube.Secrets(secret.Namespace)
 	found, err := kube.Get(context.TODO(), secret.Name, metav1.GetOptions{})
 	if err != nil {
@@ -125,7 +246,9 @@ func (c secretClient) Replace(secret types.Secret) error {
 		return err
 	}
 
-	found.Data = c.getValidSecretData(secret)
+	if err := c.setData(found, data); err != nil {
+		return err
+	}
 
 	_, err = kube.Update(context.TODO(), found, metav1.UpdateOptions{})
 	if err != nil {
@@ -149,24 +272,58 @@ func (c secretClient) GetSecrets(namespace string, secretNames []string) (map[st
 	opts := metav1.GetOptions{}
 
 	secrets := map[string]*apiv1.Secret{}
+	missing := []string{}
 	for _, secretName := range secretNames {
 		secret, err := kube.Get(context.TODO(), secretName, opts)
 		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				missing = append(missing, secretName)
+				continue
+			}
 			return nil, err
 		}
 		secrets[secretName] = secret
 	}
 
+	// report every missing secret at once, rather than one per deployment attempt
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("secrets not found in %s: %s", namespace, strings.Join(missing, ", "))
+	}
+
 	return secrets, nil
 }
 
+// setData sets the data of the Kubernetes Secret, encrypting it when a kek is configured
+func (c secretClient) setData(secret *apiv1.Secret, data map[string][]byte) error {
+	delete(secret.Annotations, SecretsEncryptedAnnotation)
+
+	if c.kek == nil {
+		secret.Data = data
+		return nil
+	}
+
+	encrypted, err := EncryptSecretData(c.kek, data)
+	if err != nil {
+		log.Printf("failed to encrypt secret %s.%s: %v\n", secret.Name, secret.Namespace, err)
+		return err
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[SecretsEncryptedAnnotation] = c.kek.ID()
+	secret.Data = encrypted
+
+	return nil
+}
+
 func (c secretClient) selector() metav1.ListOptions {
 	return metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("%s=%s", secretLabel, secretLabelValue),
 	}
 }
 
-func (c secretClient) validateSecret(secret types.Secret) error {
+func (c secretClient) validateSecret(secret Secret) error {
 	if strings.TrimSpace(secret.Namespace) == "" {
 		return errors.New("namespace may not be empty")
 	}
@@ -178,18 +335,45 @@ func (c secretClient) validateSecret(secret types.Secret) error {
 	return nil
 }
 
-func (c secretClient) getValidSecretData(secret types.Secret) map[string][]byte {
+// getValidSecretData returns the data for the Kubernetes secret. A single value is stored
+// under a key equal to the name of the secret, otherwise each key of Data and RawData is
+// stored as given.
+func (c secretClient) getValidSecretData(secret Secret) (map[string][]byte, error) {
+	if len(secret.Data) == 0 && len(secret.RawData) == 0 {
+		if len(secret.RawValue) > 0 {
+			return map[string][]byte{
+				secret.Name: secret.RawValue,
+			}, nil
+		}
 
-	if len(secret.RawValue) > 0 {
 		return map[string][]byte{
-			secret.Name: secret.RawValue,
+			secret.Name: []byte(secret.Value),
+		}, nil
+	}
+
+	if len(secret.Value) > 0 || len(secret.RawValue) > 0 {
+		return nil, k8serrors.NewBadRequest("value and rawValue can not be combined with data or rawData")
+	}
+
+	data := map[string][]byte{}
+	for key, value := range secret.Data {
+		data[key] = []byte(value)
+	}
+
+	for key, value := range secret.RawData {
+		if _, ok := data[key]; ok {
+			return nil, k8serrors.NewBadRequest(fmt.Sprintf("key %q is given in both data and rawData", key))
 		}
+		data[key] = value
 	}
 
-	return map[string][]byte{
-		secret.Name: []byte(secret.Value),
+	for key := range data {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return nil, k8serrors.NewBadRequest(fmt.Sprintf("invalid key %q: %s", key, strings.Join(errs, ", ")))
+		}
 	}
 
+	return data, nil
 }
 
 // ConfigureSecrets will update the Deployment spec to include secrets that have been deployed
@@ -199,6 +383,23 @@ func (c secretClient) getValidSecretData(secret types.Secret) map[string][]byte
 func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, deployment *appsv1.Deployment, existingSecrets map[string]*apiv1.Secret) error {
 	// Add / reference pre-existing secrets within Kubernetes
 	secretVolumeProjections := []apiv1.VolumeProjection{}
+	directories := secretDirectories(request.Annotations)
+	decrypt := needsDecryption(request.Secrets, existingSecrets)
+	if decrypt && f.Config.SecretDecryption == nil {
+		return fmt.Errorf("function %s uses encrypted secrets, but secret decryption is not configured", request.Service)
+	}
+
+	// paths maps each file or directory seen by the function to the secret providing it,
+	// so that two secrets can not silently write to the same path
+	paths := map[string]string{}
+	claim := func(path, secretName string) error {
+		if other, ok := paths[path]; ok {
+			return k8serrors.NewBadRequest(fmt.Sprintf("secrets %s and %s both write %s/%s, list one of them in the %s annotation",
+				other, secretName, secretsMountPath, path, SecretsDirectoryAnnotation))
+		}
+		paths[path] = secretName
+		return nil
+	}
 
 	for _, secretName := range request.Secrets {
 		deployedSecret, ok := existingSecrets[secretName]
@@ -219,9 +420,38 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, dep
 			)
 		default:
 
+			if directories[secretName] {
+				if err := claim(secretName, secretName); err != nil {
+					return err
+				}
+			}
+
 			projectedPaths := []apiv1.KeyToPath{}
 			for secretKey := range deployedSecret.Data {
-				projectedPaths = append(projectedPaths, apiv1.KeyToPath{Key: secretKey, Path: secretKey})
+				path := secretKey
+				// the decrypt-secrets init container needs a directory per secret
+				if directories[secretName] || decrypt {
+					path = secretName + "/" + secretKey
+				}
+				projectedPaths = append(projectedPaths, apiv1.KeyToPath{Key: secretKey, Path: path})
+			}
+
+			// sort the paths so that the spec is stable between updates
+			sort.Slice(projectedPaths, func(i, j int) bool {
+				return projectedPaths[i].Key < projectedPaths[j].Key
+			})
+
+			if !directories[secretName] {
+				_, encrypted := deployedSecret.Annotations[SecretsEncryptedAnnotation]
+				for _, projected := range projectedPaths {
+					// the envelope is read by the init container, and not written out
+					if encrypted && projected.Key == secretEnvelopeKey {
+						continue
+					}
+					if err := claim(projected.Key, secretName); err != nil {
+						return err
+					}
+				}
 			}
 
 			projection := &apiv1.SecretProjection{Items: projectedPaths}
@@ -251,17 +481,26 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, dep
 		deployment.Spec.Template.Spec.Volumes = append(existingVolumes, projectedSecrets)
 	}
 
+	// when decrypting, the function reads the secrets written by the init container rather
+	// than the projected volume
+	mountName := volumeName
+	decryptedVolumeName := f.configureSecretDecryption(request, deployment, volumeName, directories, decrypt)
+	if decrypt {
+		mountName = decryptedVolumeName
+	}
+
 	// add mount secret as a file
 	updatedContainers := []apiv1.Container{}
 	for _, container := range deployment.Spec.Template.Spec.Containers {
 		mount := apiv1.VolumeMount{
-			Name:      volumeName,
+			Name:      mountName,
 			ReadOnly:  true,
 			MountPath: secretsMountPath,
 		}
 
 		// remove the existing secrets volume mount, if we can find it. We update it later.
 		container.VolumeMounts = removeVolumeMount(volumeName, container.VolumeMounts)
+		container.VolumeMounts = removeVolumeMount(decryptedVolumeName, container.VolumeMounts)
 		if len(secretVolumeProjections) > 0 {
 			container.VolumeMounts = append(container.VolumeMounts, mount)
 		}
@@ -271,9 +510,120 @@ func (f *FunctionFactory) ConfigureSecrets(request types.FunctionDeployment, dep
 
 	deployment.Spec.Template.Spec.Containers = updatedContainers
 
+	return configureSecretEnvVars(request, deployment, existingSecrets)
+}
+
+// configureSecretEnvVars adds an environment variable to the function's container for each
+// secret in the SecretsEnvAnnotation. A variable with the same name from the request's
+// EnvVars is replaced.
+func configureSecretEnvVars(request types.FunctionDeployment, deployment *appsv1.Deployment, existingSecrets map[string]*apiv1.Secret) error {
+	if request.Annotations == nil || len(deployment.Spec.Template.Spec.Containers) == 0 {
+		return nil
+	}
+
+	envVars, err := ReadSecretEnvVars(*request.Annotations)
+	if err != nil {
+		return err
+	}
+
+	container := &deployment.Spec.Template.Spec.Containers[0]
+	for _, envVar := range envVars {
+		secret, ok := existingSecrets[envVar.Secret]
+		if !ok {
+			return fmt.Errorf("secret %s in %s must also be listed in the function's secrets", envVar.Secret, SecretsEnvAnnotation)
+		}
+
+		if _, ok := secret.Data[envVar.Key]; !ok {
+			return fmt.Errorf("secret %s in %s has no key: %s", envVar.Secret, SecretsEnvAnnotation, envVar.Key)
+		}
+
+		if _, ok := secret.Annotations[SecretsEncryptedAnnotation]; ok {
+			return fmt.Errorf("secret %s in %s is encrypted, and can only be read from a file", envVar.Secret, SecretsEnvAnnotation)
+		}
+
+		env := apiv1.EnvVar{
+			Name: envVar.Name,
+			ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: envVar.Secret},
+					Key:                  envVar.Key,
+				},
+			},
+		}
+
+		replaced := false
+		for i := range container.Env {
+			if container.Env[i].Name == envVar.Name {
+				container.Env[i] = env
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			container.Env = append(container.Env, env)
+		}
+	}
+
 	return nil
 }
 
+// ReadSecretEnvVars parses the SecretsEnvAnnotation
+func ReadSecretEnvVars(annotations map[string]string) ([]SecretEnvVar, error) {
+	value, ok := annotations[SecretsEnvAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	envVars := []SecretEnvVar{}
+	names := map[string]bool{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		source, name, ok := strings.Cut(entry, "=")
+		if !ok || source == "" || name == "" {
+			return nil, fmt.Errorf("%s: %q must be in the form secret=ENV_VAR or secret/key=ENV_VAR", SecretsEnvAnnotation, entry)
+		}
+
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: invalid environment variable %q: %s", SecretsEnvAnnotation, name, strings.Join(errs, ", "))
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("%s: environment variable %q is given more than once", SecretsEnvAnnotation, name)
+		}
+		names[name] = true
+
+		secret, key, ok := strings.Cut(source, "/")
+		if !ok {
+			key = secret
+		}
+
+		envVars = append(envVars, SecretEnvVar{Secret: secret, Key: key, Name: name})
+	}
+
+	return envVars, nil
+}
+
+// secretDirectories returns the secrets listed in the SecretsDirectoryAnnotation
+func secretDirectories(annotations *map[string]string) map[string]bool {
+	directories := map[string]bool{}
+	if annotations == nil {
+		return directories
+	}
+
+	for _, name := range strings.Split((*annotations)[SecretsDirectoryAnnotation], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			directories[name] = true
+		}
+	}
+
+	return directories
+}
+
 // ReadFunctionSecretsSpec parses the name of the required function secrets. This is the inverse of ConfigureSecrets.
 func ReadFunctionSecretsSpec(item appsv1.Deployment) []string {
 	secrets := []string{}
@@ -291,13 +641,29 @@ func ReadFunctionSecretsSpec(item appsv1.Deployment) []string {
 		}
 	}
 
+	found := map[string]bool{}
 	for _, s := range sourceSecrets {
 		if s.Secret == nil {
 			continue
 		}
+		found[s.Secret.Name] = true
 		secrets = append(secrets, s.Secret.Name)
 	}
 
+	// secrets may also be referenced only through environment variables
+	if len(item.Spec.Template.Spec.Containers) > 0 {
+		for _, env := range item.Spec.Template.Spec.Containers[0].Env {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+				continue
+			}
+
+			if name := env.ValueFrom.SecretKeyRef.Name; !found[name] {
+				found[name] = true
+				secrets = append(secrets, name)
+			}
+		}
+	}
+
 	sort.Strings(secrets)
 	return secrets
 }
@@ -0,0 +1,254 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/secretbackend"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretBackendAnnotation records the backend which a Kubernetes Secret was copied from,
+// only secrets with this annotation are removed when they are deleted from the backend
+const SecretBackendAnnotation = "com.openfaas.secrets.backend"
+
+var secretsResource = schema.GroupResource{Resource: "secrets"}
+
+// backendSecretClient writes secrets through to a backend, then copies them into a
+// Kubernetes Secret so that they can be mounted by ConfigureSecrets straight away.
+// Listing and reading use the Kubernetes Secrets.
+type backendSecretClient struct {
+	secretClient
+	backend secretbackend.Backend
+}
+
+// NewBackendSecretsClient constructs a SecretsClient which stores the values of secrets
+// in the backend
+func NewBackendSecretsClient(kube kubernetes.Interface, backend secretbackend.Backend) SecretsClient {
+	return &backendSecretClient{
+		secretClient: secretClient{kube: kube.CoreV1()},
+		backend:      backend,
+	}
+}
+
+func (c backendSecretClient) Create(secret Secret) error {
+	data, err := c.backendData(secret)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.backend.Get(secret.Namespace, secret.Name); err == nil {
+		return k8serrors.NewAlreadyExists(secretsResource, secret.Name)
+	} else if !errors.Is(err, secretbackend.ErrNotFound) {
+		log.Printf("failed to read secret %s.%s from %s: %v\n", secret.Name, secret.Namespace, c.backend.Name(), err)
+		return err
+	}
+
+	return c.put(secret, data)
+}
+
+func (c backendSecretClient) Replace(secret Secret) error {
+	data, err := c.backendData(secret)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.backend.Get(secret.Namespace, secret.Name); err != nil {
+		if errors.Is(err, secretbackend.ErrNotFound) {
+			return k8serrors.NewNotFound(secretsResource, secret.Name)
+		}
+		log.Printf("failed to read secret %s.%s from %s: %v\n", secret.Name, secret.Namespace, c.backend.Name(), err)
+		return err
+	}
+
+	return c.put(secret, data)
+}
+
+func (c backendSecretClient) Delete(namespace string, name string) error {
+	if err := c.backend.Delete(namespace, name); err != nil {
+		if errors.Is(err, secretbackend.ErrNotFound) {
+			return k8serrors.NewNotFound(secretsResource, name)
+		}
+		log.Printf("can not delete %s.%s from %s: %v\n", name, namespace, c.backend.Name(), err)
+		return err
+	}
+
+	err := c.kube.Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		log.Printf("can not delete %s.%s: %v\n", name, namespace, err)
+		return err
+	}
+
+	return nil
+}
+
+func (c backendSecretClient) backendData(secret Secret) (map[string][]byte, error) {
+	if err := c.validateSecret(secret); err != nil {
+		return nil, err
+	}
+
+	return c.getValidSecretData(secret)
+}
+
+func (c backendSecretClient) put(secret Secret, data map[string][]byte) error {
+	if err := c.backend.Put(secret.Namespace, secret.Name, data); err != nil {
+		log.Printf("failed to write secret %s.%s to %s: %v\n", secret.Name, secret.Namespace, c.backend.Name(), err)
+		return err
+	}
+
+	if err := applyBackendSecret(context.TODO(), c.kube, c.backend.Name(), secret.Namespace, secret.Name, data); err != nil {
+		log.Printf("failed to copy secret %s.%s from %s: %v\n", secret.Name, secret.Namespace, c.backend.Name(), err)
+		return err
+	}
+
+	log.Printf("wrote secret %s.%s to %s\n", secret.Name, secret.Namespace, c.backend.Name())
+	return nil
+}
+
+// applyBackendSecret creates or updates the Kubernetes Secret for a secret held by the
+// backend. A Secret of the same name which is not managed by OpenFaaS is left alone.
+func applyBackendSecret(ctx context.Context, kube SecretInterfacer, backend, namespace, name string, data map[string][]byte) error {
+	secrets := kube.Secrets(namespace)
+
+	found, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return err
+		}
+
+		_, err = secrets.Create(ctx, &apiv1.Secret{
+			Type: apiv1.SecretTypeOpaque,
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      map[string]string{secretLabel: secretLabelValue},
+				Annotations: map[string]string{SecretBackendAnnotation: backend},
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+		return err
+	}
+
+	if found.Labels[secretLabel] != secretLabelValue {
+		return fmt.Errorf("secret %s.%s already exists and is not managed by OpenFaaS", name, namespace)
+	}
+
+	if found.Annotations[SecretBackendAnnotation] == backend && equalSecretData(found.Data, data) {
+		return nil
+	}
+
+	if found.Annotations == nil {
+		found.Annotations = map[string]string{}
+	}
+	found.Annotations[SecretBackendAnnotation] = backend
+	found.Data = data
+
+	_, err = secrets.Update(ctx, found, metav1.UpdateOptions{})
+	return err
+}
+
+func equalSecretData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// SecretSync copies the secrets of a backend into Kubernetes Secrets labelled as managed
+// by OpenFaaS, so that changes made directly to the backend reach functions. Secrets
+// which were copied from the backend and have since been removed from it are deleted.
+type SecretSync struct {
+	kube       SecretInterfacer
+	backend    secretbackend.Backend
+	namespaces func() []string
+	interval   time.Duration
+}
+
+// NewSecretSync creates a SecretSync for the namespaces returned by the namespaces func
+func NewSecretSync(kube kubernetes.Interface, backend secretbackend.Backend, namespaces func() []string, interval time.Duration) *SecretSync {
+	return &SecretSync{
+		kube:       kube.CoreV1(),
+		backend:    backend,
+		namespaces: namespaces,
+		interval:   interval,
+	}
+}
+
+// Run syncs every interval until the context is cancelled
+func (s *SecretSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, namespace := range s.namespaces() {
+			if err := s.Sync(ctx, namespace); err != nil {
+				log.Printf("Unable to sync secrets in %s from %s: %s", namespace, s.backend.Name(), err.Error())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync copies the secrets of one namespace from the backend
+func (s *SecretSync) Sync(ctx context.Context, namespace string) error {
+	names, err := s.backend.List(namespace)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		data, err := s.backend.Get(namespace, name)
+		if err != nil {
+			if errors.Is(err, secretbackend.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		wanted[name] = true
+
+		if err := applyBackendSecret(ctx, s.kube, s.backend.Name(), namespace, name, data); err != nil {
+			log.Printf("Unable to sync secret %s.%s from %s: %s", name, namespace, s.backend.Name(), err.Error())
+		}
+	}
+
+	existing, err := s.kube.Secrets(namespace).List(ctx, secretClient{}.selector())
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range existing.Items {
+		if wanted[secret.Name] || secret.Annotations[SecretBackendAnnotation] != s.backend.Name() {
+			continue
+		}
+
+		err := s.kube.Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			log.Printf("Unable to delete secret %s.%s removed from %s: %s", secret.Name, namespace, s.backend.Name(), err.Error())
+		}
+	}
+
+	return nil
+}
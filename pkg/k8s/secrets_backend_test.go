@@ -0,0 +1,110 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/secretbackend"
+	types "github.com/openfaas/faas-provider/types"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_BackendSecretsClient_WritesThrough(t *testing.T) {
+	backend, err := secretbackend.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	kube := fake.NewSimpleClientset()
+	client := NewBackendSecretsClient(kube, backend)
+
+	secret := Secret{Secret: types.Secret{Name: "api-key", Namespace: "openfaas-fn", Value: "v1"}}
+	if err := client.Create(secret); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := client.Create(secret); !k8serrors.IsAlreadyExists(err) {
+		t.Fatalf("want AlreadyExists creating a secret twice, got %v", err)
+	}
+
+	secret.Value = "v2"
+	if err := client.Replace(secret); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stored, err := backend.Get("openfaas-fn", "api-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(stored["api-key"]) != "v2" {
+		t.Fatalf("want v2 in the backend, got %q", stored["api-key"])
+	}
+
+	found, err := kube.CoreV1().Secrets("openfaas-fn").Get(context.TODO(), "api-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(found.Data["api-key"]) != "v2" {
+		t.Fatalf("want v2 in the Kubernetes Secret, got %q", found.Data["api-key"])
+	}
+	if found.Labels[secretLabel] != secretLabelValue || found.Annotations[SecretBackendAnnotation] != "file" {
+		t.Fatalf("want managed label and backend annotation, got %v %v", found.Labels, found.Annotations)
+	}
+
+	if err := client.Delete("openfaas-fn", "api-key"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := kube.CoreV1().Secrets("openfaas-fn").Get(context.TODO(), "api-key", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want Kubernetes Secret to be deleted, got %v", err)
+	}
+	if err := client.Replace(secret); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want NotFound replacing a deleted secret, got %v", err)
+	}
+}
+
+func Test_SecretSync_Sync(t *testing.T) {
+	backend, err := secretbackend.NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	backend.Put("openfaas-fn", "db", map[string][]byte{"password": []byte("s3cr3t")})
+
+	managed := map[string]string{secretLabel: secretLabelValue}
+	kube := fake.NewSimpleClientset(
+		// removed from the backend since the last sync
+		&apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "openfaas-fn", Labels: managed,
+			Annotations: map[string]string{SecretBackendAnnotation: "file"}}},
+		// created before the backend was enabled
+		&apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "openfaas-fn", Labels: managed}},
+	)
+
+	s := NewSecretSync(kube, backend, func() []string { return []string{"openfaas-fn"} }, time.Minute)
+	if err := s.Sync(context.TODO(), "openfaas-fn"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	secrets := kube.CoreV1().Secrets("openfaas-fn")
+
+	db, err := secrets.Get(context.TODO(), "db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want db to be created: %s", err)
+	}
+	if string(db.Data["password"]) != "s3cr3t" {
+		t.Fatalf("want password from the backend, got %q", db.Data["password"])
+	}
+
+	if _, err := secrets.Get(context.TODO(), "old", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want old to be deleted, got %v", err)
+	}
+
+	if _, err := secrets.Get(context.TODO(), "api-key", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want api-key to be kept: %s", err)
+	}
+}
@@ -0,0 +1,520 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// SecretsEncryptedAnnotation is set on a Kubernetes Secret whose values are encrypted,
+	// to the ID of the key encryption key which wraps its data key
+	SecretsEncryptedAnnotation = "com.openfaas.secrets.encrypted"
+
+	// secretEnvelopeKey holds the wrapped data key within an encrypted Secret, so that it
+	// is projected alongside the values for the decrypt-secrets init container
+	secretEnvelopeKey = ".envelope"
+
+	// encryptedSecretsMountPath is where the decrypt-secrets init container reads the
+	// projected secrets from
+	encryptedSecretsMountPath = "/var/openfaas/encrypted-secrets"
+
+	secretsDecryptContainerName = "decrypt-secrets"
+	secretsDecryptedVolumeTmpl  = "%s-decrypted-secrets"
+
+	dataKeySize = 32
+)
+
+// KeyEncryptionKey wraps and unwraps the data keys which encrypt the values of secrets
+type KeyEncryptionKey interface {
+	// ID identifies the key, so that secrets encrypted with another key are detected
+	ID() string
+
+	// Wrap encrypts a data key
+	Wrap(dek []byte) ([]byte, error)
+
+	// Unwrap decrypts a data key
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// NewKeyEncryptionKey creates the key encryption key of the given kind, either "file"
+// which reads an AES-256 key from keyFile, or "vault-transit" which uses the named key of
+// the transit secrets engine of a Vault server
+func NewKeyEncryptionKey(kind, keyFile, vaultAddr, vaultToken, vaultKey string) (KeyEncryptionKey, error) {
+	switch kind {
+	case "file":
+		return NewFileKEK(keyFile)
+	case "vault-transit":
+		return NewVaultTransitKEK(vaultAddr, vaultToken, vaultKey)
+	default:
+		return nil, fmt.Errorf("unknown key encryption key: %q", kind)
+	}
+}
+
+// FileKEK is an AES-256 key read from a file provisioned onto each node, which the
+// decrypt-secrets init container mounts with a hostPath volume so that the key is never
+// stored in etcd. The file holds the key encoded as base64, in the same way as the
+// aesgcm provider of the Kubernetes EncryptionConfiguration.
+type FileKEK struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewFileKEK reads the key from path
+func NewFileKEK(path string) (*FileKEK, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key encryption key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("key encryption key in %s must be base64 encoded: %w", path, err)
+	}
+
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("key encryption key in %s must be %d bytes, got: %d", path, dataKeySize, len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(key)
+	return &FileKEK{
+		id:   "file:" + hex.EncodeToString(sum[:8]),
+		aead: aead,
+	}, nil
+}
+
+// ID is derived from a hash of the key
+func (k *FileKEK) ID() string {
+	return k.id
+}
+
+// Wrap encrypts the data key with AES-GCM
+func (k *FileKEK) Wrap(dek []byte) ([]byte, error) {
+	return seal(k.aead, dek, nil)
+}
+
+// Unwrap decrypts the data key
+func (k *FileKEK) Unwrap(wrapped []byte) ([]byte, error) {
+	return unseal(k.aead, wrapped, nil)
+}
+
+// VaultTransitKEK wraps data keys with the transit secrets engine of HashiCorp Vault, so
+// that the key encryption key never leaves Vault
+type VaultTransitKEK struct {
+	addr   string
+	token  string
+	key    string
+	client *http.Client
+}
+
+// NewVaultTransitKEK creates a VaultTransitKEK for the named transit key
+func NewVaultTransitKEK(addr, token, key string) (*VaultTransitKEK, error) {
+	if addr == "" || token == "" || key == "" {
+		return nil, errors.New("an address, token and key are required for the vault-transit key encryption key")
+	}
+
+	return &VaultTransitKEK{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		key:    key,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// ID is the name of the transit key
+func (k *VaultTransitKEK) ID() string {
+	return "vault-transit:" + k.key
+}
+
+// Wrap encrypts the data key, the result includes the version of the transit key
+func (k *VaultTransitKEK) Wrap(dek []byte) ([]byte, error) {
+	res := struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}{}
+
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dek)}
+	if err := k.post("encrypt", body, &res); err != nil {
+		return nil, err
+	}
+
+	return []byte(res.Data.Ciphertext), nil
+}
+
+// Unwrap decrypts the data key
+func (k *VaultTransitKEK) Unwrap(wrapped []byte) ([]byte, error) {
+	res := struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}{}
+
+	if err := k.post("decrypt", map[string]string{"ciphertext": string(wrapped)}, &res); err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(res.Data.Plaintext)
+}
+
+func (k *VaultTransitKEK) post(op string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/transit/%s/%s", k.addr, op, k.key), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", k.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("vault transit %s returned %d: %s", op, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// secretEnvelope is stored under secretEnvelopeKey in an encrypted Secret
+type secretEnvelope struct {
+	Version int    `json:"version"`
+	KEK     string `json:"kek"`
+	DEK     []byte `json:"dek"`
+}
+
+// EncryptSecretData encrypts each value with AES-GCM using a new data key, which is
+// wrapped by the key encryption key and stored alongside the values. The name of each
+// key is authenticated, so that values can not be swapped between keys.
+func EncryptSecretData(kek KeyEncryptionKey, data map[string][]byte) (map[string][]byte, error) {
+	if _, ok := data[secretEnvelopeKey]; ok {
+		return nil, k8serrors.NewBadRequest(fmt.Sprintf("key %q is reserved for encrypted secrets", secretEnvelopeKey))
+	}
+
+	dek := make([]byte, dataKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make(map[string][]byte, len(data)+1)
+	for key, value := range data {
+		sealed, err := seal(aead, value, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		encrypted[key] = sealed
+	}
+
+	wrapped, err := kek.Wrap(dek)
+	if err != nil {
+		return nil, fmt.Errorf("unable to wrap data key: %w", err)
+	}
+
+	envelope, err := json.Marshal(secretEnvelope{Version: 1, KEK: kek.ID(), DEK: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	encrypted[secretEnvelopeKey] = envelope
+
+	return encrypted, nil
+}
+
+// DecryptSecretData is the inverse of EncryptSecretData
+func DecryptSecretData(kek KeyEncryptionKey, data map[string][]byte) (map[string][]byte, error) {
+	raw, ok := data[secretEnvelopeKey]
+	if !ok {
+		return nil, errors.New("secret is not encrypted")
+	}
+
+	envelope := secretEnvelope{}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("unable to parse envelope: %w", err)
+	}
+
+	if envelope.Version != 1 {
+		return nil, fmt.Errorf("unsupported envelope version: %d", envelope.Version)
+	}
+
+	if envelope.KEK != kek.ID() {
+		return nil, fmt.Errorf("secret was encrypted with key %s, not %s", envelope.KEK, kek.ID())
+	}
+
+	dek, err := kek.Unwrap(envelope.DEK)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make(map[string][]byte, len(data)-1)
+	for key, value := range data {
+		if key == secretEnvelopeKey {
+			continue
+		}
+
+		plain, err := unseal(aead, value, []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt key %q: %w", key, err)
+		}
+		decrypted[key] = plain
+	}
+
+	return decrypted, nil
+}
+
+// needsDecryption returns true when any of the function's secrets are encrypted
+func needsDecryption(secretNames []string, existingSecrets map[string]*apiv1.Secret) bool {
+	for _, name := range secretNames {
+		secret, ok := existingSecrets[name]
+		if !ok {
+			continue
+		}
+		if _, ok := secret.Annotations[SecretsEncryptedAnnotation]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// configureSecretDecryption removes the decrypt-secrets init container and its volumes,
+// then adds them back when decrypt is true. The init container reads the projected
+// secrets volume and writes the decrypted files to an in-memory volume, which is returned
+// so that it can be mounted by the function instead of the projected volume.
+func (f *FunctionFactory) configureSecretDecryption(request types.FunctionDeployment, deployment *appsv1.Deployment, projectedVolume string, directories map[string]bool, decrypt bool) string {
+	decryptedVolume := fmt.Sprintf(secretsDecryptedVolumeTmpl, request.Service)
+	kekVolume := request.Service + "-secrets-kek"
+
+	spec := &deployment.Spec.Template.Spec
+	spec.Volumes = removeVolume(decryptedVolume, spec.Volumes)
+	spec.Volumes = removeVolume(kekVolume, spec.Volumes)
+
+	initContainers := spec.InitContainers[:0]
+	for _, c := range spec.InitContainers {
+		if c.Name != secretsDecryptContainerName {
+			initContainers = append(initContainers, c)
+		}
+	}
+	spec.InitContainers = initContainers
+
+	if !decrypt {
+		return decryptedVolume
+	}
+
+	cfg := f.Config.SecretDecryption
+
+	spec.Volumes = append(spec.Volumes, apiv1.Volume{
+		Name: decryptedVolume,
+		VolumeSource: apiv1.VolumeSource{
+			EmptyDir: &apiv1.EmptyDirVolumeSource{Medium: apiv1.StorageMediumMemory},
+		},
+	})
+
+	dirs := []string{}
+	for name := range directories {
+		dirs = append(dirs, name)
+	}
+	sort.Strings(dirs)
+
+	container := apiv1.Container{
+		Name:    secretsDecryptContainerName,
+		Image:   cfg.Image,
+		Command: []string{"./faas-netes"},
+		Args: []string{
+			"decrypt-secrets",
+			"-src=" + encryptedSecretsMountPath,
+			"-dst=" + secretsMountPath,
+			"-directories=" + strings.Join(dirs, ","),
+		},
+		Env: []apiv1.EnvVar{
+			{Name: "secret_encryption_kek", Value: cfg.KEK},
+		},
+		VolumeMounts: []apiv1.VolumeMount{
+			{Name: projectedVolume, ReadOnly: true, MountPath: encryptedSecretsMountPath},
+			{Name: decryptedVolume, MountPath: secretsMountPath},
+		},
+	}
+
+	switch cfg.KEK {
+	case "file":
+		// the KEK is read from the node rather than a Secret, so that it is kept out of
+		// the datastore which holds the secrets it encrypts
+		hostPathType := apiv1.HostPathDirectory
+		spec.Volumes = append(spec.Volumes, apiv1.Volume{
+			Name: kekVolume,
+			VolumeSource: apiv1.VolumeSource{
+				HostPath: &apiv1.HostPathVolumeSource{
+					Path: cfg.KEKHostPath,
+					Type: &hostPathType,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+			Name: kekVolume, ReadOnly: true, MountPath: filepath.Dir(cfg.KEKFile),
+		})
+		container.Env = append(container.Env, apiv1.EnvVar{Name: "secret_encryption_kek_file", Value: cfg.KEKFile})
+	case "vault-transit":
+		container.Env = append(container.Env,
+			apiv1.EnvVar{Name: "secret_encryption_vault_addr", Value: cfg.VaultAddr},
+			apiv1.EnvVar{Name: "secret_encryption_vault_key", Value: cfg.VaultKey},
+			apiv1.EnvVar{
+				Name: "secret_encryption_vault_token",
+				ValueFrom: &apiv1.EnvVarSource{
+					SecretKeyRef: &apiv1.SecretKeySelector{
+						LocalObjectReference: apiv1.LocalObjectReference{Name: cfg.VaultTokenSecret},
+						Key:                  "token",
+					},
+				},
+			})
+	}
+
+	spec.InitContainers = append(spec.InitContainers, container)
+
+	return decryptedVolume
+}
+
+// DecryptSecretsDir is run by the decrypt-secrets init container. The src directory holds
+// a directory per secret as projected by ConfigureSecrets, i.e. <src>/<secret>/<key>.
+// Encrypted secrets are decrypted and every key is written to dst, either as <dst>/<key>
+// or as <dst>/<secret>/<key> for the secrets listed in directories.
+func DecryptSecretsDir(kek KeyEncryptionKey, src, dst string, directories map[string]bool) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// skip the ..data and timestamped directories of the projected volume
+		secret := entry.Name()
+		if strings.HasPrefix(secret, "..") {
+			continue
+		}
+
+		data, err := readSecretDir(filepath.Join(src, secret))
+		if err != nil {
+			return fmt.Errorf("unable to read secret %s: %w", secret, err)
+		}
+
+		if _, ok := data[secretEnvelopeKey]; ok {
+			if kek == nil {
+				return fmt.Errorf("secret %s is encrypted, but no key encryption key is configured", secret)
+			}
+
+			if data, err = DecryptSecretData(kek, data); err != nil {
+				return fmt.Errorf("unable to decrypt secret %s: %w", secret, err)
+			}
+		}
+
+		dir := dst
+		if directories[secret] {
+			dir = filepath.Join(dst, secret)
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		for key, value := range data {
+			if err := os.WriteFile(filepath.Join(dir, key), value, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readSecretDir(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data[entry.Name()] = value
+	}
+
+	return data, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns the nonce followed by the ciphertext
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func unseal(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
@@ -0,0 +1,288 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestFileKEK(t *testing.T) *FileKEK {
+	t.Helper()
+
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	path := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	kek, err := NewFileKEK(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return kek
+}
+
+func Test_EncryptSecretData_RoundTrip(t *testing.T) {
+	kek := newTestFileKEK(t)
+	data := map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")}
+
+	encrypted, err := EncryptSecretData(kek, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(encrypted["tls.key"]) == "key" {
+		t.Fatal("want value to be encrypted")
+	}
+	if _, ok := encrypted[secretEnvelopeKey]; !ok {
+		t.Fatal("want envelope key in the encrypted data")
+	}
+
+	decrypted, err := DecryptSecretData(kek, encrypted)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(data, decrypted) {
+		t.Fatalf("want %v, got %v", data, decrypted)
+	}
+}
+
+func Test_DecryptSecretData_DetectsTampering(t *testing.T) {
+	kek := newTestFileKEK(t)
+
+	encrypted, err := EncryptSecretData(kek, map[string][]byte{"a": []byte("1"), "b": []byte("2")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	encrypted["a"], encrypted["b"] = encrypted["b"], encrypted["a"]
+	if _, err := DecryptSecretData(kek, encrypted); err == nil {
+		t.Fatal("want error when values are swapped between keys")
+	}
+
+	if _, err := DecryptSecretData(newTestFileKEK(t), encrypted); err == nil {
+		t.Fatal("want error when decrypting with another key")
+	}
+}
+
+func Test_EncryptSecretData_ReservedKey(t *testing.T) {
+	if _, err := EncryptSecretData(newTestFileKEK(t), map[string][]byte{secretEnvelopeKey: []byte("x")}); err == nil {
+		t.Fatal("want error for the reserved envelope key")
+	}
+}
+
+func Test_VaultTransitKEK_WrapUnwrap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/openfaas":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/openfaas":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	kek, err := NewVaultTransitKEK(srv.URL, "root", "openfaas")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := map[string][]byte{"api-key": []byte("secret")}
+	encrypted, err := EncryptSecretData(kek, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	decrypted, err := DecryptSecretData(kek, encrypted)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(data, decrypted) {
+		t.Fatalf("want %v, got %v", data, decrypted)
+	}
+}
+
+func Test_EncryptedSecretsClient_CreateAndList(t *testing.T) {
+	kek := newTestFileKEK(t)
+	kube := fake.NewSimpleClientset()
+	client := NewEncryptedSecretsClient(kube, kek)
+
+	err := client.Create(Secret{Secret: types.Secret{Name: "api-key", Namespace: "openfaas-fn", Value: "secret"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	found, err := kube.CoreV1().Secrets("openfaas-fn").Get(context.TODO(), "api-key", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if found.Annotations[SecretsEncryptedAnnotation] != kek.ID() {
+		t.Fatalf("want encrypted annotation %q, got %v", kek.ID(), found.Annotations)
+	}
+	if string(found.Data["api-key"]) == "secret" {
+		t.Fatal("want value to be encrypted at rest")
+	}
+
+	secrets, err := client.List("openfaas-fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(secrets) != 1 || !reflect.DeepEqual(secrets[0].Keys, []string{"api-key"}) {
+		t.Fatalf("want only the api-key key to be listed, got %+v", secrets)
+	}
+}
+
+func Test_FunctionFactory_ConfigureSecrets_Encrypted(t *testing.T) {
+	f := mockFactory()
+	existingSecrets := map[string]*apiv1.Secret{
+		"api-key": {
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{SecretsEncryptedAnnotation: "file:abc"}},
+			Type:       apiv1.SecretTypeOpaque,
+			Data:       map[string][]byte{"api-key": []byte("sealed"), secretEnvelopeKey: []byte("{}")},
+		},
+	}
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "testfunc"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "testfunc", Image: "alpine:latest"}},
+				},
+			},
+		},
+	}
+
+	req := types.FunctionDeployment{Service: "testfunc", Secrets: []string{"api-key"}}
+
+	if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err == nil {
+		t.Fatal("want error when secret decryption is not configured")
+	}
+
+	f.Config.SecretDecryption = &SecretDecryptionConfig{
+		Image:       "ghcr.io/openfaas/faas-netes:latest",
+		KEK:         "file",
+		KEKFile:     "/var/openfaas/kek/kek",
+		KEKHostPath: "/etc/openfaas/kek",
+	}
+
+	if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	spec := deployment.Spec.Template.Spec
+	if len(spec.InitContainers) != 1 || spec.InitContainers[0].Name != secretsDecryptContainerName {
+		t.Fatalf("want decrypt-secrets init container, got %+v", spec.InitContainers)
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Name != "testfunc-secrets-kek" {
+			continue
+		}
+		if volume.Secret != nil || volume.HostPath == nil || volume.HostPath.Path != "/etc/openfaas/kek" {
+			t.Fatalf("want the KEK to be mounted from the node, got %+v", volume.VolumeSource)
+		}
+	}
+
+	mounts := spec.Containers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].Name != "testfunc-decrypted-secrets" || mounts[0].MountPath != secretsMountPath {
+		t.Fatalf("want function to mount the decrypted secrets, got %+v", mounts)
+	}
+
+	paths := []string{}
+	for _, item := range spec.Volumes[0].Projected.Sources[0].Secret.Items {
+		paths = append(paths, item.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"api-key/" + secretEnvelopeKey, "api-key/api-key"}) {
+		t.Fatalf("want a directory per secret for the init container, got %v", paths)
+	}
+
+	// a plain secret no longer needs the init container
+	existingSecrets["api-key"] = &apiv1.Secret{Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"api-key": []byte("secret")}}
+	if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	spec = deployment.Spec.Template.Spec
+	if len(spec.InitContainers) != 0 || len(spec.Volumes) != 1 {
+		t.Fatalf("want init container and its volumes removed, got %+v %+v", spec.InitContainers, spec.Volumes)
+	}
+	if mounts := spec.Containers[0].VolumeMounts; len(mounts) != 1 || mounts[0].Name != "testfunc-projected-secrets" {
+		t.Fatalf("want function to mount the projected secrets, got %+v", mounts)
+	}
+}
+
+func Test_DecryptSecretsDir(t *testing.T) {
+	kek := newTestFileKEK(t)
+
+	encrypted, err := EncryptSecretData(kek, map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	src := t.TempDir()
+	write := func(secret string, data map[string][]byte) {
+		dir := filepath.Join(src, "..2024_01_01", secret)
+		os.MkdirAll(dir, 0755)
+		for key, value := range data {
+			os.WriteFile(filepath.Join(dir, key), value, 0644)
+		}
+		// projected volumes link each top level entry into the timestamped directory
+		os.Symlink(filepath.Join("..2024_01_01", secret), filepath.Join(src, secret))
+	}
+	write("tls", encrypted)
+	write("api-key", map[string][]byte{"api-key": []byte("plain")})
+
+	dst := t.TempDir()
+	if err := DecryptSecretsDir(kek, src, dst, map[string]bool{"tls": true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"api-key":     "plain",
+		"tls/tls.crt": "cert",
+		"tls/tls.key": "key",
+	}
+	for path, value := range want {
+		got, err := os.ReadFile(filepath.Join(dst, path))
+		if err != nil {
+			t.Fatalf("want %s to be written: %s", path, err)
+		}
+		if string(got) != value {
+			t.Fatalf("want %s to be %q, got %q", path, value, got)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "tls", secretEnvelopeKey)); err == nil {
+		t.Fatal("want envelope not to be written")
+	}
+}
@@ -5,12 +5,15 @@ package k8s
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	types "github.com/openfaas/faas-provider/types"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func Test_ReadFunctionSecretsSpec(t *testing.T) {
@@ -270,3 +273,211 @@ func validateNewSecretVolumesAndMounts(t *testing.T, deployment *appsv1.Deployme
 		t.Errorf("Incorrect volume mount path: expected \"%s\", got \"%s\"", secretsMountPath, mount.MountPath)
 	}
 }
+
+func Test_FunctionFactory_ConfigureSecrets_Directory(t *testing.T) {
+	f := mockFactory()
+	existingSecrets := map[string]*apiv1.Secret{
+		"tls":     {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"tls.key": []byte("key"), "tls.crt": []byte("cert")}},
+		"api-key": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"api-key": []byte("secret")}},
+	}
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "testfunc"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{Name: "testfunc", Image: "alpine:latest"},
+					},
+				},
+			},
+		},
+	}
+
+	req := types.FunctionDeployment{
+		Service:     "testfunc",
+		Secrets:     []string{"api-key", "tls"},
+		Annotations: &map[string]string{SecretsDirectoryAnnotation: "tls"},
+	}
+
+	if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := deployment.Spec.Template.Spec.Volumes[0].Projected.Sources
+
+	want := map[string][]string{
+		"api-key": {"api-key"},
+		"tls":     {"tls/tls.crt", "tls/tls.key"},
+	}
+
+	for _, source := range sources {
+		paths := []string{}
+		for _, item := range source.Secret.Items {
+			paths = append(paths, item.Path)
+		}
+
+		if !reflect.DeepEqual(paths, want[source.Secret.Name]) {
+			t.Errorf("secret %s, want paths: %v, got: %v", source.Secret.Name, want[source.Secret.Name], paths)
+		}
+	}
+
+	if got := ReadFunctionSecretsSpec(deployment); !reflect.DeepEqual(got, []string{"api-key", "tls"}) {
+		t.Errorf("want secrets to be read back, got: %v", got)
+	}
+}
+
+func Test_FunctionFactory_ConfigureSecrets_PathCollisions(t *testing.T) {
+	existingSecrets := map[string]*apiv1.Secret{
+		"db-a":    {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("a"), "user": []byte("a")}},
+		"db-b":    {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"password": []byte("b")}},
+		"tls":     {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"tls.key": []byte("key")}},
+		"aliased": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"tls": []byte("value")}},
+	}
+
+	cases := []struct {
+		name        string
+		secrets     []string
+		directories string
+		wantErr     bool
+	}{
+		{name: "shared key", secrets: []string{"db-a", "db-b"}, wantErr: true},
+		{name: "shared key in directories", secrets: []string{"db-a", "db-b"}, directories: "db-a,db-b"},
+		{name: "shared key with one directory", secrets: []string{"db-a", "db-b"}, directories: "db-b"},
+		{name: "key named after directory", secrets: []string{"tls", "aliased"}, directories: "tls", wantErr: true},
+		{name: "no overlap", secrets: []string{"db-a", "tls"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mockFactory()
+			deployment := appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{
+					Template: apiv1.PodTemplateSpec{
+						Spec: apiv1.PodSpec{Containers: []apiv1.Container{{Name: "testfunc"}}},
+					},
+				},
+			}
+
+			req := types.FunctionDeployment{
+				Service:     "testfunc",
+				Secrets:     tc.secrets,
+				Annotations: &map[string]string{SecretsDirectoryAnnotation: tc.directories},
+			}
+
+			err := f.ConfigureSecrets(req, &deployment, existingSecrets)
+			if tc.wantErr && !k8serrors.IsBadRequest(err) {
+				t.Fatalf("want bad request for colliding paths, got: %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func Test_FunctionFactory_ConfigureSecrets_EnvVars(t *testing.T) {
+	f := mockFactory()
+	existingSecrets := map[string]*apiv1.Secret{
+		"tls":     {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"tls.key": []byte("key"), "tls.crt": []byte("cert")}},
+		"api-key": {Type: apiv1.SecretTypeOpaque, Data: map[string][]byte{"api-key": []byte("secret")}},
+	}
+
+	newDeployment := func() appsv1.Deployment {
+		return appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "testfunc"},
+			Spec: appsv1.DeploymentSpec{
+				Template: apiv1.PodTemplateSpec{
+					Spec: apiv1.PodSpec{
+						Containers: []apiv1.Container{
+							{Name: "testfunc", Image: "alpine:latest", Env: []apiv1.EnvVar{{Name: "API_KEY", Value: "plain"}}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("adds secret key references", func(t *testing.T) {
+		deployment := newDeployment()
+		req := types.FunctionDeployment{
+			Service:     "testfunc",
+			Secrets:     []string{"api-key", "tls"},
+			Annotations: &map[string]string{SecretsEnvAnnotation: "api-key=API_KEY,tls/tls.key=TLS_KEY"},
+		}
+
+		if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err != nil {
+			t.Fatal(err)
+		}
+
+		env := deployment.Spec.Template.Spec.Containers[0].Env
+		if len(env) != 2 {
+			t.Fatalf("want the plain API_KEY to be replaced and TLS_KEY added, got: %v", env)
+		}
+
+		if ref := env[0].ValueFrom.SecretKeyRef; ref.Name != "api-key" || ref.Key != "api-key" {
+			t.Errorf("want API_KEY from api-key, got: %v", ref)
+		}
+
+		if ref := env[1].ValueFrom.SecretKeyRef; env[1].Name != "TLS_KEY" || ref.Name != "tls" || ref.Key != "tls.key" {
+			t.Errorf("want TLS_KEY from tls/tls.key, got: %v", env[1])
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		deployment := newDeployment()
+		req := types.FunctionDeployment{
+			Service:     "testfunc",
+			Secrets:     []string{"tls"},
+			Annotations: &map[string]string{SecretsEnvAnnotation: "tls/ca.crt=CA"},
+		}
+
+		if err := f.ConfigureSecrets(req, &deployment, existingSecrets); err == nil {
+			t.Fatal("want error for a key which does not exist")
+		}
+	})
+}
+
+func Test_ReadFunctionSecretsSpec_EnvOnly(t *testing.T) {
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "testfunc"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{
+							Name: "testfunc",
+							Env: []apiv1.EnvVar{
+								{Name: "PLAIN", Value: "value"},
+								{Name: "API_KEY", ValueFrom: &apiv1.EnvVarSource{SecretKeyRef: &apiv1.SecretKeySelector{
+									LocalObjectReference: apiv1.LocalObjectReference{Name: "api-key"},
+									Key:                  "api-key",
+								}}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if got := ReadFunctionSecretsSpec(deployment); !reflect.DeepEqual(got, []string{"api-key"}) {
+		t.Fatalf("want secret referenced by env, got: %v", got)
+	}
+}
+
+func Test_SecretsClient_GetSecrets_ReportsAllMissing(t *testing.T) {
+	kube := fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-key", Namespace: "openfaas-fn"},
+	})
+
+	_, err := NewSecretsClient(kube).GetSecrets("openfaas-fn", []string{"db-password", "api-key", "tls"})
+	if err == nil {
+		t.Fatal("want error for missing secrets")
+	}
+
+	want := "secrets not found in openfaas-fn: db-password, tls"
+	if err.Error() != want {
+		t.Fatalf("want error: %q, got: %q", want, err.Error())
+	}
+}
@@ -0,0 +1,170 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ServiceAccountAnnotation is the name of the ServiceAccount the function runs as.
+	// When it is not set, the namespace's default ServiceAccount is used, or the
+	// function's own ServiceAccount when ServiceAccountCreateAnnotation is true.
+	ServiceAccountAnnotation = "com.openfaas.serviceaccount"
+
+	// ServiceAccountCreateAnnotation creates a ServiceAccount for the function when
+	// "true", which is named after the function unless ServiceAccountAnnotation is set.
+	// A ServiceAccount named after the function is deleted along with it, one with
+	// another name may be shared by several functions and is kept.
+	ServiceAccountCreateAnnotation = "com.openfaas.serviceaccount.create"
+
+	// ServiceAccountTokenAnnotation mounts the ServiceAccount's API token into the
+	// function when "true". It is false by default so that functions do not receive
+	// credentials for the Kubernetes API which they do not need.
+	ServiceAccountTokenAnnotation = "com.openfaas.serviceaccount.token"
+)
+
+// ServiceAccountSpec is the ServiceAccount configuration of a function
+type ServiceAccountSpec struct {
+	// Name of the ServiceAccount, empty for the namespace's default
+	Name string
+
+	// Create the ServiceAccount for the function
+	Create bool
+
+	// AutomountToken mounts the API token into the function
+	AutomountToken bool
+}
+
+// ReadServiceAccountSpec parses the ServiceAccount annotations of a function
+func ReadServiceAccountSpec(request types.FunctionDeployment) (ServiceAccountSpec, error) {
+	spec := ServiceAccountSpec{}
+	if request.Annotations == nil {
+		return spec, nil
+	}
+	annotations := *request.Annotations
+
+	if v, ok := annotations[ServiceAccountCreateAnnotation]; ok {
+		create, err := strconv.ParseBool(v)
+		if err != nil {
+			return spec, fmt.Errorf("%s must be true or false, got: %q", ServiceAccountCreateAnnotation, v)
+		}
+		spec.Create = create
+	}
+
+	if v, ok := annotations[ServiceAccountTokenAnnotation]; ok {
+		automount, err := strconv.ParseBool(v)
+		if err != nil {
+			return spec, fmt.Errorf("%s must be true or false, got: %q", ServiceAccountTokenAnnotation, v)
+		}
+		spec.AutomountToken = automount
+	}
+
+	spec.Name = strings.TrimSpace(annotations[ServiceAccountAnnotation])
+	if spec.Name == "" && spec.Create {
+		spec.Name = request.Service
+	}
+
+	if spec.Name != "" {
+		if errs := validation.IsDNS1123Subdomain(spec.Name); len(errs) > 0 {
+			return spec, fmt.Errorf("%s: invalid name %q: %s", ServiceAccountAnnotation, spec.Name, strings.Join(errs, ", "))
+		}
+	}
+
+	return spec, nil
+}
+
+// ConfigureServiceAccount sets the ServiceAccount of the function's Pods, and whether
+// its API token is mounted. This method is safe for both create and update operations.
+func (f *FunctionFactory) ConfigureServiceAccount(request types.FunctionDeployment, deployment *appsv1.Deployment) error {
+	spec, err := ReadServiceAccountSpec(request)
+	if err != nil {
+		return err
+	}
+
+	automount := spec.AutomountToken
+	deployment.Spec.Template.Spec.ServiceAccountName = spec.Name
+	deployment.Spec.Template.Spec.AutomountServiceAccountToken = &automount
+
+	return nil
+}
+
+// EnsureServiceAccount creates the function's ServiceAccount when it has asked for one
+// and it does not exist. An existing ServiceAccount is used as it is.
+func (f *FunctionFactory) EnsureServiceAccount(ctx context.Context, namespace string, request types.FunctionDeployment) error {
+	spec, err := ReadServiceAccountSpec(request)
+	if err != nil || !spec.Create {
+		return err
+	}
+
+	accounts := f.Client.CoreV1().ServiceAccounts(namespace)
+	if _, err := accounts.Get(ctx, spec.Name, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	// only a ServiceAccount named after the function belongs to it, see
+	// DeleteFunctionServiceAccounts
+	labels := map[string]string{secretLabel: secretLabelValue}
+	if spec.Name == request.Service {
+		labels["faas_function"] = request.Service
+	}
+
+	automount := false
+	_, err = accounts.Create(ctx, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		AutomountServiceAccountToken: &automount,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		if k8serrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("ServiceAccount created: %s.%s\n", spec.Name, namespace)
+	return nil
+}
+
+// DeleteFunctionServiceAccounts removes the ServiceAccount created for a function, which
+// is named after the function. ServiceAccounts with other names may be shared with other
+// functions, so they are never deleted.
+func DeleteFunctionServiceAccounts(ctx context.Context, client kubernetes.Interface, namespace, functionName string) error {
+	accounts := client.CoreV1().ServiceAccounts(namespace)
+	sa, err := accounts.Get(ctx, functionName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if sa.Labels["faas_function"] != functionName || sa.Labels[secretLabel] != secretLabelValue {
+		return nil
+	}
+
+	if err := accounts.Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	log.Printf("ServiceAccount deleted: %s.%s\n", sa.Name, namespace)
+
+	return nil
+}
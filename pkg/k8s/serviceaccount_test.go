@@ -0,0 +1,172 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	types "github.com/openfaas/faas-provider/types"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ReadServiceAccountSpec(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        ServiceAccountSpec
+		wantErr     bool
+	}{
+		{
+			name: "default service account without a token",
+			want: ServiceAccountSpec{},
+		},
+		{
+			name:        "existing service account",
+			annotations: map[string]string{ServiceAccountAnnotation: "reader"},
+			want:        ServiceAccountSpec{Name: "reader"},
+		},
+		{
+			name:        "created service account is named after the function",
+			annotations: map[string]string{ServiceAccountCreateAnnotation: "true"},
+			want:        ServiceAccountSpec{Name: "figlet", Create: true},
+		},
+		{
+			name:        "token is mounted when requested",
+			annotations: map[string]string{ServiceAccountAnnotation: "reader", ServiceAccountTokenAnnotation: "true"},
+			want:        ServiceAccountSpec{Name: "reader", AutomountToken: true},
+		},
+		{
+			name:        "invalid name",
+			annotations: map[string]string{ServiceAccountAnnotation: "Reader_1"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid toggle",
+			annotations: map[string]string{ServiceAccountTokenAnnotation: "yes please"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := types.FunctionDeployment{Service: "figlet"}
+			if tc.annotations != nil {
+				req.Annotations = &tc.annotations
+			}
+
+			got, err := ReadServiceAccountSpec(req)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Fatalf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ConfigureServiceAccount_DisablesTokenByDefault(t *testing.T) {
+	f := mockFactory()
+	deployment := &appsv1.Deployment{}
+	deployment.Spec.Template.Spec.ServiceAccountName = "previous"
+
+	if err := f.ConfigureServiceAccount(types.FunctionDeployment{Service: "figlet"}, deployment); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	spec := deployment.Spec.Template.Spec
+	if spec.ServiceAccountName != "" {
+		t.Fatalf("want the default service account, got %q", spec.ServiceAccountName)
+	}
+	if spec.AutomountServiceAccountToken == nil || *spec.AutomountServiceAccountToken {
+		t.Fatal("want the service account token not to be mounted")
+	}
+}
+
+func Test_EnsureServiceAccount_CreatesAndDeletes(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+	namespace := "openfaas-fn"
+
+	f.Client.CoreV1().ServiceAccounts(namespace).Create(ctx, &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: namespace},
+	}, metav1.CreateOptions{})
+
+	req := types.FunctionDeployment{
+		Service:     "figlet",
+		Annotations: &map[string]string{ServiceAccountCreateAnnotation: "true"},
+	}
+
+	if err := f.EnsureServiceAccount(ctx, namespace, req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// a second call finds the existing service account
+	if err := f.EnsureServiceAccount(ctx, namespace, req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	sa, err := f.Client.CoreV1().ServiceAccounts(namespace).Get(ctx, "figlet", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want service account to be created: %s", err)
+	}
+	if sa.Labels["faas_function"] != "figlet" {
+		t.Fatalf("want faas_function label, got %v", sa.Labels)
+	}
+
+	if err := DeleteFunctionServiceAccounts(ctx, f.Client, namespace, "figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := f.Client.CoreV1().ServiceAccounts(namespace).Get(ctx, "figlet", metav1.GetOptions{}); !k8serrors.IsNotFound(err) {
+		t.Fatalf("want service account to be deleted, got %v", err)
+	}
+	if _, err := f.Client.CoreV1().ServiceAccounts(namespace).Get(ctx, "shared", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want unmanaged service account to be kept: %s", err)
+	}
+}
+
+func Test_DeleteFunctionServiceAccounts_KeepsSharedServiceAccount(t *testing.T) {
+	f := mockFactory()
+	ctx := context.TODO()
+	namespace := "openfaas-fn"
+
+	for _, service := range []string{"figlet", "nodeinfo"} {
+		req := types.FunctionDeployment{
+			Service: service,
+			Annotations: &map[string]string{
+				ServiceAccountCreateAnnotation: "true",
+				ServiceAccountAnnotation:       "shared",
+			},
+		}
+		if err := f.EnsureServiceAccount(ctx, namespace, req); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	sa, err := f.Client.CoreV1().ServiceAccounts(namespace).Get(ctx, "shared", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("want shared service account to be created: %s", err)
+	}
+	if _, ok := sa.Labels["faas_function"]; ok {
+		t.Fatalf("want no faas_function label on a shared service account, got %v", sa.Labels)
+	}
+
+	if err := DeleteFunctionServiceAccounts(ctx, f.Client, namespace, "figlet"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := f.Client.CoreV1().ServiceAccounts(namespace).Get(ctx, "shared", metav1.GetOptions{}); err != nil {
+		t.Fatalf("want shared service account to be kept: %s", err)
+	}
+}
@@ -0,0 +1,189 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	types "github.com/openfaas/faas-provider/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// podMetricsPath is the path of the PodMetrics API served by metrics-server
+	podMetricsPath = "/apis/metrics.k8s.io/v1beta1"
+
+	// podMetricsTimeout is the maximum time to wait for the PodMetrics API
+	podMetricsTimeout = 5 * time.Second
+)
+
+// podMetricsList is the subset of the metrics.k8s.io/v1beta1 PodMetricsList
+// which is read to calculate the usage of functions
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+type podMetrics struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Containers []containerMetrics `json:"containers"`
+}
+
+type containerMetrics struct {
+	Name  string              `json:"name"`
+	Usage corev1.ResourceList `json:"usage"`
+}
+
+// podMetricsFetcher returns the raw PodMetricsList for the pods matching selector
+type podMetricsFetcher func(ctx context.Context, namespace, selector string) ([]byte, error)
+
+// FunctionUsageReader reads the CPU and memory usage of functions from the metrics.k8s.io
+// API. Results are cached per namespace for the TTL so that listing functions does not
+// result in a query per function. When metrics-server is not installed, no usage is reported.
+type FunctionUsageReader struct {
+	fetch podMetricsFetcher
+	ttl   time.Duration
+
+	lock        sync.Mutex
+	cache       map[string]usageCacheEntry
+	unavailable bool
+
+	// inflight is closed when the query for a namespace completes, so that concurrent
+	// callers wait for one query instead of each making their own
+	inflight map[string]chan struct{}
+}
+
+type usageCacheEntry struct {
+	usage   map[string]types.FunctionUsage
+	expires time.Time
+}
+
+// NewFunctionUsageReader creates a FunctionUsageReader which caches usage for the ttl
+func NewFunctionUsageReader(client kubernetes.Interface, ttl time.Duration) *FunctionUsageReader {
+	restClient := client.Discovery().RESTClient()
+
+	fetch := func(ctx context.Context, namespace, selector string) ([]byte, error) {
+		return restClient.Get().
+			AbsPath(podMetricsPath, "namespaces", namespace, "pods").
+			Param("labelSelector", selector).
+			Do(ctx).
+			Raw()
+	}
+
+	return &FunctionUsageReader{
+		fetch: fetch,
+		ttl:   ttl,
+		cache: map[string]usageCacheEntry{},
+	}
+}
+
+// Usage returns the total CPU and memory used by all replicas of the function, or nil
+// when no usage is available.
+func (r *FunctionUsageReader) Usage(name, namespace string) *types.FunctionUsage {
+	usage, ok := r.namespaceUsage(namespace)[name]
+	if !ok {
+		return nil
+	}
+
+	return &usage
+}
+
+// namespaceUsage returns the cached usage of the namespace, or queries the PodMetrics
+// API when it has expired. The lock is not held during the query, so a slow
+// metrics-server does not block readers of other namespaces.
+func (r *FunctionUsageReader) namespaceUsage(namespace string) map[string]types.FunctionUsage {
+	r.lock.Lock()
+	if entry, ok := r.cache[namespace]; ok && time.Now().Before(entry.expires) {
+		r.lock.Unlock()
+		return entry.usage
+	}
+
+	if done, ok := r.inflight[namespace]; ok {
+		r.lock.Unlock()
+		<-done
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		return r.cache[namespace].usage
+	}
+
+	if r.inflight == nil {
+		r.inflight = map[string]chan struct{}{}
+	}
+	done := make(chan struct{})
+	r.inflight[namespace] = done
+	r.lock.Unlock()
+
+	usage, err := r.readNamespace(namespace)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err != nil {
+		if !r.unavailable {
+			log.Printf("Function usage unavailable, is metrics-server installed? %s\n", err)
+		}
+		r.unavailable = true
+	} else {
+		if r.unavailable {
+			log.Printf("Function usage available from metrics.k8s.io\n")
+		}
+		r.unavailable = false
+	}
+
+	r.cache[namespace] = usageCacheEntry{
+		usage:   usage,
+		expires: time.Now().Add(r.ttl),
+	}
+	delete(r.inflight, namespace)
+	close(done)
+
+	return usage
+}
+
+// readNamespace queries the PodMetrics for all function pods in the namespace and sums
+// the usage of each pod's containers by function. An error is returned when the API
+// could not be queried, and is logged once by the caller until the API has recovered.
+func (r *FunctionUsageReader) readNamespace(namespace string) (map[string]types.FunctionUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), podMetricsTimeout)
+	defer cancel()
+
+	res, err := r.fetch(ctx, namespace, "faas_function")
+	if err != nil {
+		return map[string]types.FunctionUsage{}, err
+	}
+
+	list := podMetricsList{}
+	if err := json.Unmarshal(res, &list); err != nil {
+		log.Printf("Unable to parse PodMetrics for %s: %s\n", namespace, err)
+		return map[string]types.FunctionUsage{}, nil
+	}
+
+	usage := map[string]types.FunctionUsage{}
+	for _, pod := range list.Items {
+		functionName, ok := pod.Labels["faas_function"]
+		if !ok {
+			continue
+		}
+
+		total := usage[functionName]
+		for _, container := range pod.Containers {
+			if cpu, ok := container.Usage[corev1.ResourceCPU]; ok {
+				total.CPU += float64(cpu.MilliValue())
+			}
+			if memory, ok := container.Usage[corev1.ResourceMemory]; ok {
+				total.TotalMemoryBytes += float64(memory.Value())
+			}
+		}
+		usage[functionName] = total
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,133 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const podMetricsJSON = `{
+  "kind": "PodMetricsList",
+  "apiVersion": "metrics.k8s.io/v1beta1",
+  "items": [
+    {
+      "metadata": {"name": "figlet-1", "labels": {"faas_function": "figlet"}},
+      "containers": [{"name": "figlet", "usage": {"cpu": "250m", "memory": "10Mi"}}]
+    },
+    {
+      "metadata": {"name": "figlet-2", "labels": {"faas_function": "figlet"}},
+      "containers": [{"name": "figlet", "usage": {"cpu": "125000000n", "memory": "6Mi"}}]
+    },
+    {
+      "metadata": {"name": "env-1", "labels": {"faas_function": "env"}},
+      "containers": [{"name": "env", "usage": {"cpu": "1m", "memory": "1Ki"}}]
+    }
+  ]
+}`
+
+func Test_FunctionUsageReader_SumsReplicas(t *testing.T) {
+	calls := 0
+	r := &FunctionUsageReader{
+		fetch: func(ctx context.Context, namespace, selector string) ([]byte, error) {
+			calls++
+			return []byte(podMetricsJSON), nil
+		},
+		ttl:   time.Minute,
+		cache: map[string]usageCacheEntry{},
+	}
+
+	usage := r.Usage("figlet", "openfaas-fn")
+	if usage == nil {
+		t.Fatal("want usage for figlet")
+	}
+
+	if usage.CPU != 375 {
+		t.Errorf("want CPU: 375 millicores, got: %f", usage.CPU)
+	}
+
+	if usage.TotalMemoryBytes != 16*1024*1024 {
+		t.Errorf("want memory: %d bytes, got: %f", 16*1024*1024, usage.TotalMemoryBytes)
+	}
+
+	if usage := r.Usage("env", "openfaas-fn"); usage == nil || usage.CPU != 1 {
+		t.Errorf("want CPU for env: 1, got: %v", usage)
+	}
+
+	if usage := r.Usage("nodeinfo", "openfaas-fn"); usage != nil {
+		t.Errorf("want no usage for function without pods, got: %v", usage)
+	}
+
+	if calls != 1 {
+		t.Errorf("want usage to be cached, got: %d calls", calls)
+	}
+}
+
+func Test_FunctionUsageReader_MetricsServerUnavailable(t *testing.T) {
+	r := &FunctionUsageReader{
+		fetch: func(ctx context.Context, namespace, selector string) ([]byte, error) {
+			return nil, fmt.Errorf("the server could not find the requested resource")
+		},
+		ttl:   time.Minute,
+		cache: map[string]usageCacheEntry{},
+	}
+
+	if usage := r.Usage("figlet", "openfaas-fn"); usage != nil {
+		t.Errorf("want no usage, got: %v", usage)
+	}
+}
+
+func Test_FunctionUsageReader_SlowFetchDoesNotBlockOtherNamespaces(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls int32
+
+	r := &FunctionUsageReader{
+		fetch: func(ctx context.Context, namespace, selector string) ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			if namespace == "slow-fn" {
+				close(started)
+				<-release
+			}
+			return []byte(podMetricsJSON), nil
+		},
+		ttl:   time.Minute,
+		cache: map[string]usageCacheEntry{},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if usage := r.Usage("figlet", "slow-fn"); usage == nil {
+				t.Errorf("want usage for figlet in slow-fn")
+			}
+		}()
+	}
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		r.Usage("figlet", "openfaas-fn")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want usage of openfaas-fn while slow-fn is being read")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("want one query per namespace, got: %d", got)
+	}
+}
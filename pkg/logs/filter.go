@@ -0,0 +1,128 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// levels ranks the log levels understood by the minimum level filter, aliases
+// share the rank of the level they stand for.
+var levels = map[string]int{
+	"trace":    1,
+	"debug":    2,
+	"info":     3,
+	"warn":     4,
+	"warning":  4,
+	"error":    5,
+	"fatal":    6,
+	"panic":    6,
+	"critical": 6,
+}
+
+// levelKeys and messageKeys are the fields read from JSON log lines, in order of preference
+var (
+	levelKeys   = []string{"level", "lvl", "severity"}
+	messageKeys = []string{"msg", "message"}
+)
+
+// Filter selects the log lines to return for a Request
+type Filter struct {
+	// Substring must be contained within the line, when set
+	Substring string
+
+	// Pattern must match the line, when set
+	Pattern *regexp.Regexp
+
+	// MinLevel is the rank of the lowest level to return, 0 returns all lines
+	MinLevel int
+}
+
+// NewFilter validates the filters within the Request and returns a Filter, or nil
+// when the Request does not filter the log lines.
+func NewFilter(r Request) (*Filter, error) {
+	if r.Filter == "" && r.Regex == "" && r.Level == "" {
+		return nil, nil
+	}
+
+	f := &Filter{Substring: r.Filter}
+
+	if r.Regex != "" {
+		pattern, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		f.Pattern = pattern
+	}
+
+	if r.Level != "" {
+		rank, ok := levels[strings.ToLower(r.Level)]
+		if !ok {
+			return nil, fmt.Errorf("invalid level: %q", r.Level)
+		}
+		f.MinLevel = rank
+	}
+
+	return f, nil
+}
+
+// Match returns true when the raw log line and its level, which may be empty, pass
+// the filter. When a minimum level is set, lines without a known level are dropped.
+func (f *Filter) Match(line, level string) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.Substring != "" && !strings.Contains(line, f.Substring) {
+		return false
+	}
+
+	if f.Pattern != nil && !f.Pattern.MatchString(line) {
+		return false
+	}
+
+	if f.MinLevel > 0 && levels[strings.ToLower(level)] < f.MinLevel {
+		return false
+	}
+
+	return true
+}
+
+// ParseJSON parses a log line written as a JSON object. The level and message are
+// lifted out of the object and the remaining keys are returned as fields. ok is false
+// when the line is not a JSON object.
+func ParseJSON(line string) (msg, level string, fields map[string]interface{}, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return "", "", nil, false
+	}
+
+	fields = map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return "", "", nil, false
+	}
+
+	level = liftString(fields, levelKeys)
+	msg = liftString(fields, messageKeys)
+
+	if len(fields) == 0 {
+		fields = nil
+	}
+
+	return msg, level, fields, true
+}
+
+// liftString removes and returns the first of keys found in fields with a string value
+func liftString(fields map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if v, ok := fields[key].(string); ok {
+			delete(fields, key)
+			return v
+		}
+	}
+	return ""
+}
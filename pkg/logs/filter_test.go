@@ -0,0 +1,85 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logs
+
+import (
+	"testing"
+)
+
+func Test_NewFilter_NoFilters(t *testing.T) {
+	f, err := NewFilter(Request{Name: "figlet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f != nil {
+		t.Fatalf("want nil filter, got: %v", f)
+	}
+
+	if !f.Match("anything", "") {
+		t.Fatalf("want a nil filter to match every line")
+	}
+}
+
+func Test_NewFilter_Invalid(t *testing.T) {
+	cases := []Request{
+		{Regex: "(unclosed"},
+		{Level: "loud"},
+	}
+
+	for _, r := range cases {
+		if _, err := NewFilter(r); err == nil {
+			t.Errorf("want error for request: %s", r)
+		}
+	}
+}
+
+func Test_Filter_Match(t *testing.T) {
+	f, err := NewFilter(Request{Filter: "order", Regex: `id=\d+`, Level: "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		line  string
+		level string
+		want  bool
+	}{
+		{line: "order failed id=12", level: "error", want: true},
+		{line: "order failed id=12", level: "WARNING", want: true},
+		{line: "order placed id=12", level: "info", want: false},
+		{line: "order failed id=12", level: "", want: false},
+		{line: "payment failed id=12", level: "error", want: false},
+		{line: "order failed id=x", level: "error", want: false},
+	}
+
+	for _, tc := range cases {
+		if got := f.Match(tc.line, tc.level); got != tc.want {
+			t.Errorf("line: %q level: %q, want: %v, got: %v", tc.line, tc.level, tc.want, got)
+		}
+	}
+}
+
+func Test_ParseJSON(t *testing.T) {
+	msg, level, fields, ok := ParseJSON(`{"level":"error","msg":"order failed","id":12}` + "\n")
+	if !ok {
+		t.Fatal("want line to be parsed as JSON")
+	}
+
+	if msg != "order failed" || level != "error" {
+		t.Fatalf("want msg and level to be lifted, got: %q %q", msg, level)
+	}
+
+	if len(fields) != 1 || fields["id"] != float64(12) {
+		t.Fatalf("want remaining fields, got: %v", fields)
+	}
+}
+
+func Test_ParseJSON_PlainText(t *testing.T) {
+	for _, line := range []string{"order failed", "{not json", `["a"]`} {
+		if _, _, _, ok := ParseJSON(line); ok {
+			t.Errorf("want %q not to be parsed as JSON", line)
+		}
+	}
+}
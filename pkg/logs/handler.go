@@ -0,0 +1,168 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/faas-provider/httputil"
+)
+
+// NewLogHandlerFunc creates an http HandlerFunc from the supplied log Requester.
+func NewLogHandlerFunc(requestor Requester, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Println("LogHandler: response is not a Flusher, required for streaming response")
+			http.NotFound(w, r)
+			return
+		}
+
+		logRequest, err := parseRequest(r)
+		if err != nil {
+			log.Printf("LogHandler: could not parse request %s", err)
+			httputil.Errorf(w, http.StatusUnprocessableEntity, "could not parse the log request")
+			return
+		}
+
+		ctx, cancelQuery := context.WithTimeout(r.Context(), timeout)
+		defer cancelQuery()
+		messages, err := requestor.Query(ctx, logRequest)
+		if err != nil {
+			if errors.Is(err, ErrBadRequest) {
+				httputil.Errorf(w, http.StatusBadRequest, "%s", err.Error())
+				return
+			}
+			httputil.Errorf(w, http.StatusInternalServerError, "function log request failed")
+			return
+		}
+
+		// Send the initial headers saying we're gonna stream the response.
+		w.Header().Set("Connection", "Keep-Alive")
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Header().Set(http.CanonicalHeaderKey("Content-Type"), "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// ensure that we always try to send the closing chunk, not the inverted order due to how
+		// the defer stack works. We need two flush statements to ensure that the empty slice is
+		// sent as its own chunk
+		defer flusher.Flush()
+		defer w.Write([]byte{})
+		defer flusher.Flush()
+
+		jsonEncoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				log.Println("LogHandler: client stopped listening")
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					log.Println("LogHandler: end of log stream")
+					return
+				}
+
+				// serialize and write the msg to the http ResponseWriter
+				if err := jsonEncoder.Encode(msg); err != nil {
+					// can't write the status header here because we have already sent the
+					// content type and status code, so serialize an error instead
+					log.Printf("LogHandler: failed to serialize log message: '%s': %s\n", msg.String(), err)
+					jsonEncoder.Encode(Message{Text: "failed to serialize log message"})
+					flusher.Flush()
+					return
+				}
+
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// parseRequest extracts the logRequest from the GET variables
+func parseRequest(r *http.Request) (logRequest Request, err error) {
+	query := r.URL.Query()
+	logRequest.Name = getValue(query, "name")
+	logRequest.Namespace = getValue(query, "namespace")
+	logRequest.Instance = getValue(query, "instance")
+	logRequest.Container = getValue(query, "container")
+
+	tailStr := getValue(query, "tail")
+	if tailStr != "" {
+		logRequest.Tail, err = strconv.Atoi(tailStr)
+		if err != nil {
+			return logRequest, err
+		}
+	}
+
+	// ignore errors because they will default to false if we can't parse them
+	logRequest.Follow, _ = strconv.ParseBool(getValue(query, "follow"))
+	logRequest.Previous, _ = strconv.ParseBool(getValue(query, "previous"))
+	logRequest.JSON, _ = strconv.ParseBool(getValue(query, "json"))
+	logRequest.Events, _ = strconv.ParseBool(getValue(query, "events"))
+
+	logRequest.Filter = getValue(query, "filter")
+	logRequest.Regex = getValue(query, "regex")
+	logRequest.Level = getValue(query, "level")
+	if _, err := NewFilter(logRequest); err != nil {
+		return logRequest, err
+	}
+
+	// the level is only known for lines which are parsed as JSON
+	if logRequest.Level != "" && !logRequest.JSON {
+		return logRequest, fmt.Errorf("level can only be used with json=true")
+	}
+
+	sinceStr := getValue(query, "since")
+	if sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			return logRequest, err
+		}
+		logRequest.Since = &since
+	}
+
+	untilStr := getValue(query, "until")
+	if untilStr != "" {
+		until, err := time.Parse(time.RFC3339, untilStr)
+		if err != nil {
+			return logRequest, err
+		}
+
+		if logRequest.Since != nil && !until.After(*logRequest.Since) {
+			return logRequest, fmt.Errorf("until must be after since")
+		}
+
+		// a followed stream only ends when the client disconnects
+		if logRequest.Follow {
+			return logRequest, fmt.Errorf("until can not be used with follow")
+		}
+		logRequest.Until = &until
+	}
+
+	return logRequest, nil
+}
+
+// getValue returns the value for the given key. If the key has more than one value, it returns the
+// last value. if the value does not exist, it returns the empty string.
+func getValue(queryValues url.Values, name string) string {
+	values := queryValues[name]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[len(values)-1]
+}
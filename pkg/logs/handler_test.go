@@ -0,0 +1,161 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRequester struct {
+	request  Request
+	messages []Message
+}
+
+func (f *fakeRequester) Query(ctx context.Context, r Request) (<-chan Message, error) {
+	f.request = r
+
+	out := make(chan Message, len(f.messages))
+	for _, m := range f.messages {
+		out <- m
+	}
+	close(out)
+	return out, nil
+}
+
+func Test_parseRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&namespace=dev&instance=figlet-1&container=*&previous=true&events=true&tail=10&since=2024-01-02T15:04:05Z&until=2024-01-02T16:04:05Z", nil)
+
+	got, err := parseRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	until := since.Add(time.Hour)
+	want := Request{
+		Name:      "figlet",
+		Namespace: "dev",
+		Instance:  "figlet-1",
+		Container: AllContainers,
+		Previous:  true,
+		Events:    true,
+		Since:     &since,
+		Until:     &until,
+		Tail:      10,
+	}
+
+	if got.String() != want.String() {
+		t.Fatalf("want request: %s, got: %s", want, got)
+	}
+}
+
+func Test_parseRequest_InvalidSince(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&since=yesterday", nil)
+
+	if _, err := parseRequest(req); err == nil {
+		t.Fatal("want error for invalid since value")
+	}
+}
+
+func Test_NewLogHandlerFunc_StreamsMessages(t *testing.T) {
+	requester := &fakeRequester{
+		messages: []Message{
+			{Name: "figlet", Instance: "figlet-1", Container: "figlet", Text: "one"},
+			{Name: "figlet", Instance: "figlet-1", Container: "figlet", Text: "two"},
+		},
+	}
+
+	handler := NewLogHandlerFunc(requester, time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&container=figlet", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	if requester.request.Container != "figlet" {
+		t.Fatalf("want container to be passed to the requester, got: %q", requester.request.Container)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 messages, got: %d", len(lines))
+	}
+
+	msg := Message{}
+	if err := json.Unmarshal([]byte(lines[1]), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Text != "two" || msg.Container != "figlet" {
+		t.Fatalf("want second message, got: %v", msg)
+	}
+}
+
+func Test_NewLogHandlerFunc_InvalidFilter(t *testing.T) {
+	handler := NewLogHandlerFunc(&fakeRequester{}, time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&regex=(unclosed", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("want status: %d, got: %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func Test_parseRequest_UntilBeforeSince(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&since=2024-01-02T15:04:05Z&until=2024-01-01T15:04:05Z", nil)
+
+	if _, err := parseRequest(req); err == nil {
+		t.Fatal("want error when until is before since")
+	}
+}
+
+type badRequester struct{}
+
+func (badRequester) Query(ctx context.Context, r Request) (<-chan Message, error) {
+	return nil, fmt.Errorf("%w: no container %q", ErrBadRequest, r.Container)
+}
+
+func Test_NewLogHandlerFunc_BadRequest(t *testing.T) {
+	handler := NewLogHandlerFunc(badRequester{}, time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&container=debug", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("want status: %d, got: %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func Test_parseRequest_UntilWithFollow(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&follow=true&until=2024-01-01T15:04:05Z", nil)
+
+	if _, err := parseRequest(req); err == nil {
+		t.Fatal("want error when until is used with follow")
+	}
+}
+
+func Test_parseRequest_LevelRequiresJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&level=warn", nil)
+	if _, err := parseRequest(req); err == nil {
+		t.Fatal("want error when level is used without json")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/system/logs?name=figlet&level=warn&json=true", nil)
+	if _, err := parseRequest(req); err != nil {
+		t.Fatalf("want level to be accepted with json, got: %s", err)
+	}
+}
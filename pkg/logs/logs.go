@@ -0,0 +1,131 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package logs provides the function log handler for faas-netes.
+//
+// It is based upon the log handler from github.com/openfaas/faas-provider/logs, and
+// extends the Request with options specific to Kubernetes, such as the container
+// to read from and whether to read the logs of the previous container.
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AllContainers can be given as the Request's Container to read the logs of every
+// container in the function's Pods.
+const AllContainers = "*"
+
+// ErrBadRequest is wrapped by a Requester's errors for requests which can not be
+// served, such as for a container which does not exist.
+var ErrBadRequest = errors.New("bad log request")
+
+// Requester submits queries to the logging system.
+type Requester interface {
+	// Query submits a log request to the actual logging system.
+	Query(context.Context, Request) (<-chan Message, error)
+}
+
+// Request is the query to return the function logs.
+type Request struct {
+	// Name is the function name and is required
+	Name string `json:"name"`
+
+	// Namespace is the namespace the function is deployed to
+	Namespace string `json:"namespace"`
+
+	// Instance is the optional Pod name, to request logs from a specific function instance
+	Instance string `json:"instance"`
+
+	// Container is the optional container name, when empty the function's container is
+	// used. Use AllContainers to read from every container in the Pod.
+	Container string `json:"container"`
+
+	// Previous requests the logs of the previously terminated container, i.e. after a crash
+	Previous bool `json:"previous"`
+
+	// Since is the optional datetime value to start the logs from
+	Since *time.Time `json:"since"`
+
+	// Until is the optional datetime value to end the logs at, it can not be used with Follow
+	Until *time.Time `json:"until"`
+
+	// Tail sets the maximum number of log messages to return, <=0 means unlimited
+	Tail int `json:"tail"`
+
+	// Follow is allows the user to request a stream of logs until the timeout
+	Follow bool `json:"follow"`
+
+	// Filter is an optional substring which each log line must contain
+	Filter string `json:"filter"`
+
+	// Regex is an optional regular expression which each log line must match
+	Regex string `json:"regex"`
+
+	// Level is the optional minimum level of the log lines to return, i.e. "warn", it
+	// requires JSON
+	Level string `json:"level"`
+
+	// JSON parses log lines which are JSON objects, lifting their level, message
+	// and fields into the Message
+	JSON bool `json:"json"`
+
+	// Events adds messages to the stream when instances are started or terminate,
+	// i.e. "instance figlet-7d4b9 terminated: OOMKilled"
+	Events bool `json:"events"`
+}
+
+// String implements that Stringer interface and prints the log Request in a consistent way that
+// allows you to safely compare if two requests have the same value.
+func (r Request) String() string {
+	return fmt.Sprintf(
+		"name: %s namespace: %s instance: %s container: %s previous: %v since: %v until: %v tail: %d follow: %v filter: %s regex: %s level: %s json: %v events: %v",
+		r.Name, r.Namespace, r.Instance, r.Container, r.Previous, r.Since, r.Until, r.Tail, r.Follow, r.Filter, r.Regex, r.Level, r.JSON, r.Events,
+	)
+}
+
+// Message is a specific log message from a function container log stream
+type Message struct {
+	// Name is the function name
+	Name string `json:"name"`
+
+	// Namespace is the namespace the function is deployed to
+	Namespace string `json:"namespace"`
+
+	// Instance is the name of the Pod for the function instance
+	Instance string `json:"instance"`
+
+	// Container is the name of the container which wrote the message
+	Container string `json:"container,omitempty"`
+
+	// Timestamp is the timestamp of when the log message was recorded
+	Timestamp time.Time `json:"timestamp"`
+
+	// Text is the raw log message content, or the message of a parsed JSON log line
+	Text string `json:"text"`
+
+	// Level is the level of a parsed JSON log line
+	Level string `json:"level,omitempty"`
+
+	// Fields are the remaining keys of a parsed JSON log line
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	// Event is true for messages added by the provider when an instance is
+	// started or terminates
+	Event bool `json:"event,omitempty"`
+}
+
+// String implements the Stringer interface and allows for nice and simple string formatting of a log Message.
+func (m Message) String() string {
+	ns := ""
+	if len(m.Namespace) > 0 {
+		ns = fmt.Sprintf("%s ", m.Namespace)
+	}
+	return fmt.Sprintf(
+		"%s %s (%s%s) %s",
+		m.Timestamp.String(), m.Name, ns, m.Instance, m.Text,
+	)
+}
@@ -0,0 +1,199 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logshipper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+// httpSinkTimeout is the maximum time to wait for a push to an HTTP sink
+const httpSinkTimeout = 10 * time.Second
+
+// LokiSink pushes messages to Loki's push API, with a stream per function instance
+type LokiSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewLokiSink creates a sink for the Loki push endpoint at url
+func NewLokiSink(url string) *LokiSink {
+	return &LokiSink{url: url, client: &http.Client{Timeout: httpSinkTimeout}}
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *LokiSink) Name() string {
+	return "loki"
+}
+
+func (s *LokiSink) Write(ctx context.Context, batch []k8s.Log) error {
+	streams := map[string]int{}
+	push := lokiPush{}
+
+	for _, msg := range batch {
+		key := msg.Namespace + "/" + msg.PodName + "/" + msg.Container
+		i, ok := streams[key]
+		if !ok {
+			push.Streams = append(push.Streams, lokiStream{
+				Stream: map[string]string{
+					"function_name": msg.FunctionName,
+					"namespace":     msg.Namespace,
+					"instance":      msg.PodName,
+					"container":     msg.Container,
+				},
+			})
+			i = len(push.Streams) - 1
+			streams[key] = i
+		}
+
+		push.Streams[i].Values = append(push.Streams[i].Values, [2]string{
+			strconv.FormatInt(msg.Timestamp.UnixNano(), 10),
+			msg.Text,
+		})
+	}
+
+	return postJSON(ctx, s.client, s.url, push)
+}
+
+func (s *LokiSink) Close() error {
+	return nil
+}
+
+// OTLPSink exports messages as OpenTelemetry log records using OTLP over HTTP with JSON
+type OTLPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPSink creates a sink for the OTLP logs endpoint at url
+func NewOTLPSink(url string) *OTLPSink {
+	return &OTLPSink{url: url, client: &http.Client{Timeout: httpSinkTimeout}}
+}
+
+type otlpLogs struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	SeverityText string          `json:"severityText,omitempty"`
+	Body         otlpValue       `json:"body"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (s *OTLPSink) Name() string {
+	return "otlp"
+}
+
+func (s *OTLPSink) Write(ctx context.Context, batch []k8s.Log) error {
+	resources := map[string]int{}
+	logs := otlpLogs{}
+
+	for _, msg := range batch {
+		key := msg.Namespace + "/" + msg.PodName
+		i, ok := resources[key]
+		if !ok {
+			logs.ResourceLogs = append(logs.ResourceLogs, otlpResourceLogs{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{
+						stringAttribute("service.name", msg.FunctionName),
+						stringAttribute("k8s.namespace.name", msg.Namespace),
+						stringAttribute("k8s.pod.name", msg.PodName),
+					},
+				},
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "faas-netes"}}},
+			})
+			i = len(logs.ResourceLogs) - 1
+			resources[key] = i
+		}
+
+		scope := &logs.ResourceLogs[i].ScopeLogs[0]
+		scope.LogRecords = append(scope.LogRecords, otlpLogRecord{
+			TimeUnixNano: strconv.FormatInt(msg.Timestamp.UnixNano(), 10),
+			SeverityText: msg.Level,
+			Body:         otlpValue{StringValue: msg.Text},
+			Attributes:   []otlpAttribute{stringAttribute("k8s.container.name", msg.Container)},
+		})
+	}
+
+	return postJSON(ctx, s.client, s.url, logs)
+}
+
+func (s *OTLPSink) Close() error {
+	return nil
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+// postJSON sends body to url as JSON, any status other than 2xx is an error
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		out, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("unexpected status code from %s: %d, body: %s", url, res.StatusCode, string(out))
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package logshipper continuously tails the logs of every function and forwards
+// them to one or more sinks, such as a file, Loki or an OTLP collector.
+package logshipper
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+)
+
+// OverflowPolicy decides what happens to log messages when a sink's buffer is full
+type OverflowPolicy string
+
+const (
+	// OverflowDrop discards new messages while a sink is slow, so that the log streams
+	// of functions are never held up by a sink
+	OverflowDrop OverflowPolicy = "drop"
+
+	// OverflowBlock stops reading from the log streams until the sink catches up
+	OverflowBlock OverflowPolicy = "block"
+)
+
+const (
+	// sinkWriteAttempts is the number of times a batch is written before it is dropped
+	sinkWriteAttempts = 3
+
+	// sinkRetryDelay is the delay before the first retry, it doubles for each attempt
+	sinkRetryDelay = time.Second
+)
+
+// Sink receives batches of log messages
+type Sink interface {
+	// Name identifies the sink in log messages
+	Name() string
+
+	// Write delivers a batch of log messages, it is retried when an error is returned
+	Write(ctx context.Context, batch []k8s.Log) error
+
+	// Close flushes and releases any resources held by the sink
+	Close() error
+}
+
+// Config configures the Shipper
+type Config struct {
+	// Namespace is the namespace of the functions to ship logs for
+	Namespace string
+
+	// BufferSize is the number of messages buffered for each sink
+	BufferSize int
+
+	// BatchSize is the maximum number of messages written to a sink at once
+	BatchSize int
+
+	// FlushInterval is the maximum time a message is held before being written
+	FlushInterval time.Duration
+
+	// ResyncInterval is how often the list of functions is checked for new functions
+	ResyncInterval time.Duration
+
+	// Overflow decides what happens when a sink's buffer is full
+	Overflow OverflowPolicy
+}
+
+// Shipper tails the logs of all functions in a namespace through GetLogs and forwards
+// the messages to each sink. Each sink has its own buffer, so a slow sink does not
+// delay the others.
+type Shipper struct {
+	client  kubernetes.Interface
+	watcher *k8s.PodWatcher
+	lister  appslisters.DeploymentLister
+	config  Config
+	workers []*sinkWorker
+
+	lock    sync.Mutex
+	tailing map[string]context.CancelFunc
+}
+
+// New creates a Shipper for the sinks
+func New(client kubernetes.Interface, watcher *k8s.PodWatcher, lister appslisters.DeploymentLister, sinks []Sink, config Config) *Shipper {
+	workers := make([]*sinkWorker, 0, len(sinks))
+	for _, sink := range sinks {
+		workers = append(workers, &sinkWorker{
+			sink:   sink,
+			queue:  make(chan k8s.Log, config.BufferSize),
+			config: config,
+		})
+	}
+
+	return &Shipper{
+		client:  client,
+		watcher: watcher,
+		lister:  lister,
+		config:  config,
+		workers: workers,
+		tailing: map[string]context.CancelFunc{},
+	}
+}
+
+// Run ships logs until ctx is cancelled, then flushes and closes the sinks
+func (s *Shipper) Run(ctx context.Context) {
+	// only ship messages written after start-up, Pods created later are shipped in full
+	since := time.Now()
+
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w *sinkWorker) {
+			defer wg.Done()
+			w.run(ctx)
+		}(w)
+	}
+
+	ticker := time.NewTicker(s.config.ResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		s.resync(ctx, since)
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resync starts tailing new functions and stops tailing those which have been removed.
+// Functions without any Pods are retried on the next resync.
+func (s *Shipper) resync(ctx context.Context, since time.Time) {
+	req, err := labels.NewRequirement("faas_function", selection.Exists, []string{})
+	if err != nil {
+		log.Printf("LogShipper: %s", err)
+		return
+	}
+
+	deployments, err := s.lister.Deployments(s.config.Namespace).List(labels.NewSelector().Add(*req))
+	if err != nil {
+		log.Printf("LogShipper: unable to list functions: %s", err)
+		return
+	}
+
+	functions := map[string]bool{}
+	for _, d := range deployments {
+		functions[d.Name] = true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for name, cancel := range s.tailing {
+		if !functions[name] {
+			cancel()
+			delete(s.tailing, name)
+		}
+	}
+
+	for name := range functions {
+		if _, ok := s.tailing[name]; ok {
+			continue
+		}
+
+		opts := k8s.LogOptions{Follow: true, Since: &since}
+		tailCtx, cancel := context.WithCancel(ctx)
+
+		messages, err := k8s.GetLogs(tailCtx, s.client, s.watcher, name, s.config.Namespace, opts)
+		if err != nil {
+			cancel()
+			continue
+		}
+
+		s.tailing[name] = cancel
+		go s.tail(tailCtx, messages)
+	}
+}
+
+// tail forwards the messages of a function to each sink
+func (s *Shipper) tail(ctx context.Context, messages <-chan k8s.Log) {
+	for msg := range messages {
+		for _, w := range s.workers {
+			w.enqueue(ctx, msg)
+		}
+	}
+}
+
+// sinkWorker batches messages for a single sink
+type sinkWorker struct {
+	sink    Sink
+	queue   chan k8s.Log
+	config  Config
+	dropped atomic.Uint64
+}
+
+// enqueue adds the message to the sink's buffer, following the overflow policy when it is full
+func (w *sinkWorker) enqueue(ctx context.Context, msg k8s.Log) {
+	if w.config.Overflow == OverflowBlock {
+		select {
+		case w.queue <- msg:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	select {
+	case w.queue <- msg:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// run writes batches to the sink when they are full, or at each flush interval
+func (w *sinkWorker) run(ctx context.Context) {
+	defer func() {
+		if err := w.sink.Close(); err != nil {
+			log.Printf("LogShipper: error closing sink %s: %s", w.sink.Name(), err)
+		}
+	}()
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]k8s.Log, 0, w.config.BatchSize)
+	flush := func() {
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			log.Printf("LogShipper: sink %s is too slow, dropped %d messages", w.sink.Name(), dropped)
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		w.write(ctx, batch)
+		batch = make([]k8s.Log, 0, w.config.BatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// write whatever is still buffered without waiting for the sink to recover
+			for {
+				select {
+				case msg := <-w.queue:
+					batch = append(batch, msg)
+				default:
+					flush()
+					return
+				}
+			}
+		case msg := <-w.queue:
+			batch = append(batch, msg)
+			if len(batch) >= w.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write delivers the batch to the sink, retrying with a back-off before dropping it
+func (w *sinkWorker) write(ctx context.Context, batch []k8s.Log) {
+	delay := sinkRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= sinkWriteAttempts; attempt++ {
+		// use a fresh context so that the final flush can complete after shutdown
+		writeCtx, cancel := context.WithTimeout(context.Background(), w.config.FlushInterval+10*time.Second)
+		err = w.sink.Write(writeCtx, batch)
+		cancel()
+
+		if err == nil {
+			return
+		}
+
+		if attempt == sinkWriteAttempts || ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+		}
+	}
+
+	log.Printf("LogShipper: dropped %d messages after failing to write to sink %s: %s", len(batch), w.sink.Name(), err)
+}
@@ -0,0 +1,117 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logshipper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+type fakeSink struct {
+	lock    sync.Mutex
+	batches [][]k8s.Log
+	fail    int
+	closed  bool
+}
+
+func (f *fakeSink) Name() string { return "fake" }
+
+func (f *fakeSink) Write(ctx context.Context, batch []k8s.Log) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("sink unavailable")
+	}
+
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func (f *fakeSink) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.closed = true
+	return nil
+}
+
+func Test_sinkWorker_DropsWhenFull(t *testing.T) {
+	w := &sinkWorker{
+		sink:   &fakeSink{},
+		queue:  make(chan k8s.Log, 2),
+		config: Config{Overflow: OverflowDrop},
+	}
+
+	for i := 0; i < 5; i++ {
+		w.enqueue(context.Background(), k8s.Log{Text: "line"})
+	}
+
+	if len(w.queue) != 2 {
+		t.Fatalf("want 2 buffered messages, got: %d", len(w.queue))
+	}
+
+	if got := w.dropped.Load(); got != 3 {
+		t.Fatalf("want 3 dropped messages, got: %d", got)
+	}
+}
+
+func Test_sinkWorker_BatchesAndFlushesOnShutdown(t *testing.T) {
+	sink := &fakeSink{}
+	w := &sinkWorker{
+		sink:   sink,
+		queue:  make(chan k8s.Log, 10),
+		config: Config{BatchSize: 2, FlushInterval: time.Hour},
+	}
+
+	for i := 0; i < 3; i++ {
+		w.enqueue(context.Background(), k8s.Log{Text: "line"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(done)
+	}()
+
+	// wait for the first full batch before stopping the worker
+	for i := 0; i < 100; i++ {
+		sink.lock.Lock()
+		written := len(sink.batches)
+		sink.lock.Unlock()
+		if written > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if len(sink.batches) != 2 || len(sink.batches[0]) != 2 || len(sink.batches[1]) != 1 {
+		t.Fatalf("want a full batch and the remainder flushed on shutdown, got: %v", sink.batches)
+	}
+
+	if !sink.closed {
+		t.Fatal("want sink to be closed")
+	}
+}
+
+func Test_sinkWorker_RetriesFailedWrites(t *testing.T) {
+	sink := &fakeSink{fail: 1}
+	w := &sinkWorker{sink: sink, config: Config{FlushInterval: time.Second}}
+
+	w.write(context.Background(), []k8s.Log{{Text: "line"}})
+
+	if len(sink.batches) != 1 {
+		t.Fatalf("want batch to be written after a retry, got: %d", len(sink.batches))
+	}
+}
@@ -0,0 +1,204 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logshipper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+// SinkConfig holds the settings for each type of sink
+type SinkConfig struct {
+	// File is the path written to by the file sink
+	File string
+
+	// FileMaxBytes is the size at which the file is rotated
+	FileMaxBytes int64
+
+	// FileMaxBackups is the number of rotated files to keep
+	FileMaxBackups int
+
+	// LokiURL is the push endpoint for the loki sink, i.e. http://loki:3100/loki/api/v1/push
+	LokiURL string
+
+	// OTLPURL is the logs endpoint for the otlp sink, i.e. http://collector:4318/v1/logs
+	OTLPURL string
+}
+
+// NewSinks creates the named sinks, the names are: stdout, file, loki and otlp.
+func NewSinks(names []string, config SinkConfig) ([]Sink, error) {
+	sinks := []Sink{}
+	for _, name := range names {
+		switch name {
+		case "stdout":
+			sinks = append(sinks, NewJSONSink("stdout", os.Stdout))
+		case "file":
+			sink, err := NewFileSink(config.File, config.FileMaxBytes, config.FileMaxBackups)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "loki":
+			if config.LokiURL == "" {
+				return nil, fmt.Errorf("a URL is required for the loki sink")
+			}
+			sinks = append(sinks, NewLokiSink(config.LokiURL))
+		case "otlp":
+			if config.OTLPURL == "" {
+				return nil, fmt.Errorf("a URL is required for the otlp sink")
+			}
+			sinks = append(sinks, NewOTLPSink(config.OTLPURL))
+		default:
+			return nil, fmt.Errorf("unknown log sink: %q", name)
+		}
+	}
+
+	return sinks, nil
+}
+
+// JSONSink writes each message as a line of JSON
+type JSONSink struct {
+	name string
+	w    io.Writer
+}
+
+// NewJSONSink creates a sink which writes a line of JSON per message to w
+func NewJSONSink(name string, w io.Writer) *JSONSink {
+	return &JSONSink{name: name, w: w}
+}
+
+func (s *JSONSink) Name() string {
+	return s.name
+}
+
+func (s *JSONSink) Write(ctx context.Context, batch []k8s.Log) error {
+	buf := bufio.NewWriter(s.w)
+	enc := json.NewEncoder(buf)
+	for _, msg := range batch {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+func (s *JSONSink) Close() error {
+	return nil
+}
+
+// FileSink writes a line of JSON per message to a file, which is rotated when it
+// reaches the maximum size. Rotated files are suffixed with .1, .2 and so on, with
+// .1 being the most recent.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens or creates the file at path for appending
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("a path is required for the file sink")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Write(ctx context.Context, batch []k8s.Log) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, msg := range batch {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts each backup up by one, removing the oldest, then starts a new file
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return err
+	}
+
+	return s.open()
+}
@@ -0,0 +1,151 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package logshipper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-netes/pkg/k8s"
+)
+
+func testBatch() []k8s.Log {
+	ts := time.Unix(1700000000, 0)
+	return []k8s.Log{
+		{FunctionName: "figlet", Namespace: "openfaas-fn", PodName: "figlet-1", Container: "figlet", Text: "one", Timestamp: ts},
+		{FunctionName: "figlet", Namespace: "openfaas-fn", PodName: "figlet-2", Container: "figlet", Text: "two", Timestamp: ts},
+		{FunctionName: "figlet", Namespace: "openfaas-fn", PodName: "figlet-1", Container: "figlet", Text: "three", Timestamp: ts},
+	}
+}
+
+func Test_NewSinks_Unknown(t *testing.T) {
+	if _, err := NewSinks([]string{"syslog"}, SinkConfig{}); err == nil {
+		t.Fatal("want error for an unknown sink")
+	}
+}
+
+func Test_NewSinks_LokiRequiresURL(t *testing.T) {
+	if _, err := NewSinks([]string{"loki"}, SinkConfig{}); err == nil {
+		t.Fatal("want error when the loki URL is missing")
+	}
+}
+
+func Test_JSONSink_WritesLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	sink := NewJSONSink("test", out)
+
+	if err := sink.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 lines, got: %d", len(lines))
+	}
+
+	msg := k8s.Log{}
+	if err := json.Unmarshal([]byte(lines[2]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "three" {
+		t.Fatalf("want text: three, got: %q", msg.Text)
+	}
+}
+
+func Test_FileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "functions.log")
+
+	// each message is larger than the limit, so every message is written to a new file
+	sink, err := NewFileSink(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{path: "three", path + ".1": "two", path + ".2": "one"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want %s to contain %q, got: %s", file, want, string(data))
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("want only 2 backups to be kept")
+	}
+}
+
+func Test_LokiSink_GroupsStreams(t *testing.T) {
+	var got lokiPush
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	if err := NewLokiSink(s.URL).Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Streams) != 2 {
+		t.Fatalf("want a stream per instance, got: %d", len(got.Streams))
+	}
+
+	first := got.Streams[0]
+	if first.Stream["instance"] != "figlet-1" || len(first.Values) != 2 {
+		t.Fatalf("want 2 values for figlet-1, got: %v", first)
+	}
+
+	if first.Values[1][0] != "1700000000000000000" || first.Values[1][1] != "three" {
+		t.Fatalf("want nanosecond timestamp and text, got: %v", first.Values[1])
+	}
+}
+
+func Test_OTLPSink_ErrorStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	if err := NewOTLPSink(s.URL).Write(context.Background(), testBatch()); err == nil {
+		t.Fatal("want error for a non-2xx status")
+	}
+}
+
+func Test_OTLPSink_GroupsResources(t *testing.T) {
+	var got otlpLogs
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer s.Close()
+
+	if err := NewOTLPSink(s.URL).Write(context.Background(), testBatch()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ResourceLogs) != 2 {
+		t.Fatalf("want a resource per instance, got: %d", len(got.ResourceLogs))
+	}
+
+	if records := got.ResourceLogs[0].ScopeLogs[0].LogRecords; len(records) != 2 || records[1].Body.StringValue != "three" {
+		t.Fatalf("want 2 records for figlet-1, got: %v", records)
+	}
+}
@@ -0,0 +1,88 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// apiLatencySamples is the number of recent requests used to summarise latency
+const apiLatencySamples = 100
+
+// APILatencySummary summarises the latency of recent requests to the Kubernetes API
+type APILatencySummary struct {
+	// Requests is the total number of requests made since start-up
+	Requests uint64 `json:"requests"`
+
+	// AverageSeconds is the mean latency of recent requests
+	AverageSeconds float64 `json:"averageSeconds"`
+
+	// MaxSeconds is the highest latency of recent requests
+	MaxSeconds float64 `json:"maxSeconds"`
+}
+
+// APILatency implements the client-go LatencyMetric interface and keeps the most
+// recent samples in memory so that they can be reported without Prometheus.
+type APILatency struct {
+	lock     sync.Mutex
+	samples  []time.Duration
+	next     int
+	requests uint64
+}
+
+// NewAPILatency creates an APILatency, register it with client-go's metrics.Register
+// before any clients are created.
+func NewAPILatency() *APILatency {
+	return &APILatency{
+		samples: make([]time.Duration, 0, apiLatencySamples),
+	}
+}
+
+// Observe records the latency of a request made by a Kubernetes REST client
+func (a *APILatency) Observe(ctx context.Context, verb string, u url.URL, latency time.Duration) {
+	// watches are long-lived, so their duration is not a measure of latency
+	if verb == "WATCH" {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.requests++
+	if len(a.samples) < apiLatencySamples {
+		a.samples = append(a.samples, latency)
+		return
+	}
+
+	a.samples[a.next] = latency
+	a.next = (a.next + 1) % apiLatencySamples
+}
+
+// Summary returns the latency of recent requests
+func (a *APILatency) Summary() APILatencySummary {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	summary := APILatencySummary{
+		Requests: a.requests,
+	}
+
+	if len(a.samples) == 0 {
+		return summary
+	}
+
+	var total time.Duration
+	for _, s := range a.samples {
+		total += s
+		if s.Seconds() > summary.MaxSeconds {
+			summary.MaxSeconds = s.Seconds()
+		}
+	}
+	summary.AverageSeconds = total.Seconds() / float64(len(a.samples))
+
+	return summary
+}
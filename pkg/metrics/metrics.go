@@ -0,0 +1,117 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package metrics records per-function invocation metrics for the function proxy,
+// which are exposed for Prometheus on the provider's /metrics endpoint.
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InvocationMetrics records R.E.D. metrics for function invocations
+// partitioned by the function name, namespace and HTTP status code.
+type InvocationMetrics struct {
+	// InvocationsTotal is a Prometheus counter vector of invocations per function.
+	InvocationsTotal *prometheus.CounterVec
+
+	// InvocationDuration is a Prometheus histogram vector of the time taken per invocation.
+	InvocationDuration *prometheus.HistogramVec
+
+	defaultNamespace string
+
+	lock   sync.RWMutex
+	counts map[functionKey]functionCounts
+}
+
+// NewInvocationMetrics creates and registers the invocation metrics. Functions invoked
+// without a namespace suffix are recorded against the defaultNamespace.
+func NewInvocationMetrics(defaultNamespace string, registerer prometheus.Registerer) *InvocationMetrics {
+	m := &InvocationMetrics{
+		InvocationsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: "provider",
+			Name:      "function_invocation_total",
+			Help:      "Total number of function invocations.",
+		}, []string{"function_name", "namespace", "code"}),
+		InvocationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: "provider",
+			Name:      "function_duration_seconds",
+			Help:      "Seconds spent serving function invocations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"function_name", "namespace", "code"}),
+		defaultNamespace: defaultNamespace,
+		counts:           map[functionKey]functionCounts{},
+	}
+
+	registerer.MustRegister(m.InvocationsTotal, m.InvocationDuration)
+
+	return m
+}
+
+// Observe records an invocation of the function, the name may be suffixed with
+// the namespace i.e. "figlet.openfaas-fn"
+func (m *InvocationMetrics) Observe(functionName string, code int, duration time.Duration) {
+	name, namespace := m.splitName(functionName)
+
+	labels := prometheus.Labels{
+		"function_name": name,
+		"namespace":     namespace,
+		"code":          strconv.Itoa(code),
+	}
+
+	m.InvocationsTotal.With(labels).Inc()
+	m.InvocationDuration.With(labels).Observe(duration.Seconds())
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := functionKey{name: name, namespace: namespace}
+	counts := m.counts[key]
+	counts.invocations++
+	if code >= 500 {
+		counts.errors++
+	}
+	m.counts[key] = counts
+}
+
+// InvocationCount returns the total number of invocations recorded for the function
+// across all status codes.
+func (m *InvocationMetrics) InvocationCount(name, namespace string) float64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.counts[functionKey{name: name, namespace: namespace}].invocations
+}
+
+// ErrorCount returns the number of invocations of the function which resulted in
+// a 5xx status code.
+func (m *InvocationMetrics) ErrorCount(name, namespace string) float64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.counts[functionKey{name: name, namespace: namespace}].errors
+}
+
+type functionKey struct {
+	name      string
+	namespace string
+}
+
+// functionCounts mirrors the counter vector per function, so that reading the
+// totals for one function does not have to collect every series
+type functionCounts struct {
+	invocations float64
+	errors      float64
+}
+
+func (m *InvocationMetrics) splitName(functionName string) (string, string) {
+	if i := strings.LastIndex(functionName, "."); i > -1 {
+		return functionName[:i], functionName[i+1:]
+	}
+	return functionName, m.defaultNamespace
+}
@@ -0,0 +1,66 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_InvocationMetrics_InvocationCount(t *testing.T) {
+	m := NewInvocationMetrics("openfaas-fn", prometheus.NewRegistry())
+
+	m.Observe("figlet", http.StatusOK, time.Millisecond)
+	m.Observe("figlet.openfaas-fn", http.StatusInternalServerError, time.Millisecond)
+	m.Observe("figlet.staging", http.StatusOK, time.Millisecond)
+	m.Observe("env", http.StatusOK, time.Millisecond)
+
+	if got := m.InvocationCount("figlet", "openfaas-fn"); got != 2 {
+		t.Errorf("want 2 invocations across status codes, got: %f", got)
+	}
+
+	if got := m.InvocationCount("figlet", "staging"); got != 1 {
+		t.Errorf("want 1 invocation in the staging namespace, got: %f", got)
+	}
+
+	if got := m.InvocationCount("nodeinfo", "openfaas-fn"); got != 0 {
+		t.Errorf("want 0 invocations for a function which was not invoked, got: %f", got)
+	}
+}
+
+func Test_InvocationMetrics_ErrorCount(t *testing.T) {
+	m := NewInvocationMetrics("openfaas-fn", prometheus.NewRegistry())
+
+	m.Observe("figlet", http.StatusOK, time.Millisecond)
+	m.Observe("figlet", http.StatusBadGateway, time.Millisecond)
+	m.Observe("figlet", http.StatusInternalServerError, time.Millisecond)
+	m.Observe("figlet", http.StatusNotFound, time.Millisecond)
+
+	if got := m.ErrorCount("figlet", "openfaas-fn"); got != 2 {
+		t.Errorf("want 2 errors, got: %f", got)
+	}
+}
+
+func Test_APILatency_Summary(t *testing.T) {
+	a := NewAPILatency()
+
+	for i := 1; i <= apiLatencySamples+10; i++ {
+		a.Observe(context.Background(), "GET", url.URL{}, time.Second)
+	}
+	a.Observe(context.Background(), "WATCH", url.URL{}, time.Hour)
+
+	summary := a.Summary()
+	if summary.Requests != apiLatencySamples+10 {
+		t.Errorf("want %d requests, got: %d", apiLatencySamples+10, summary.Requests)
+	}
+
+	if summary.AverageSeconds != 1 || summary.MaxSeconds != 1 {
+		t.Errorf("want average and max of 1s excluding watches, got: %v", summary)
+	}
+}
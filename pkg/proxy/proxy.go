@@ -0,0 +1,440 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package proxy provides the function invocation proxy for faas-netes.
+//
+// It is based upon the proxy from github.com/openfaas/faas-provider, and adds
+// settings which can be configured per function through annotations, such as
+// the retry policy and timeout for an invocation.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	fhttputil "github.com/openfaas/faas-provider/httputil"
+	"github.com/openfaas/faas-provider/types"
+)
+
+const (
+	defaultContentType     = "text/plain"
+	openFaaSInternalHeader = "X-OpenFaaS-Internal"
+)
+
+// BaseURLResolver resolves the URL, including the port, of one of the function's endpoints. Any
+// endpoints passed in exclude should be avoided when an alternative is available.
+type BaseURLResolver interface {
+	ResolveExcluding(functionName string, exclude []url.URL) (url.URL, error)
+}
+
+// AnnotationReader returns the annotations of a function, which are used to
+// read its per-function proxy settings.
+type AnnotationReader interface {
+	Annotations(functionName string) (map[string]string, error)
+}
+
+// InvocationRecorder records the status code and duration of each invocation
+type InvocationRecorder interface {
+	Observe(functionName string, code int, duration time.Duration)
+}
+
+// NewHandlerFunc creates a http.HandlerFunc to proxy function requests.
+// When verbose is set to true, the timing of each invocation will be printed out to
+// stderr. The annotations reader is optional, when nil the default settings are used
+// for all functions. The recorder is optional, when set each invocation is recorded.
+//
+// Note that this will panic if `resolver` is nil.
+func NewHandlerFunc(config types.FaaSConfig, resolver BaseURLResolver, annotations AnnotationReader, recorder InvocationRecorder, verbose bool) http.HandlerFunc {
+	if resolver == nil {
+		panic("NewHandlerFunc: empty proxy handler resolver, cannot be nil")
+	}
+
+	proxyClient := NewProxyClientFromConfig(config)
+
+	reverseProxy := httputil.ReverseProxy{}
+	reverseProxy.Director = func(req *http.Request) {
+		// At least an empty director is required to prevent runtime errors.
+		req.URL.Scheme = "http"
+	}
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			fhttputil.Errorf(w, http.StatusGatewayTimeout, "Function timed out: %s.", mux.Vars(r)["name"])
+		}
+	}
+
+	// Errors are common during disconnect of client, no need to log them.
+	reverseProxy.ErrorLog = log.New(io.Discard, "", 0)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			defer r.Body.Close()
+		}
+
+		switch r.Method {
+		case http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodGet,
+			http.MethodOptions,
+			http.MethodHead:
+			if recorder == nil {
+				proxyRequest(w, r, proxyClient, resolver, annotations, &reverseProxy, verbose)
+				return
+			}
+
+			start := time.Now()
+			ww := fhttputil.NewHttpWriteInterceptor(w)
+			resolved := proxyRequest(ww, r, proxyClient, resolver, annotations, &reverseProxy, verbose)
+
+			// Only functions which exist are recorded, otherwise any caller could create
+			// a new series for each name it invokes
+			if resolved {
+				recorder.Observe(mux.Vars(r)["name"], ww.Status(), time.Since(start))
+			}
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// NewProxyClientFromConfig creates a new http.Client designed for proxying requests and enforcing
+// certain minimum configuration values.
+func NewProxyClientFromConfig(config types.FaaSConfig) *http.Client {
+	return NewProxyClient(config.GetReadTimeout(), config.GetMaxIdleConns(), config.GetMaxIdleConnsPerHost())
+}
+
+// NewProxyClient creates a new http.Client designed for proxying requests, this is exposed as a
+// convenience method for internal or advanced uses. Most people should use NewProxyClientFromConfig.
+func NewProxyClient(timeout time.Duration, maxIdleConns int, maxIdleConnsPerHost int) *http.Client {
+	return &http.Client{
+		// See the faas-provider proxy package for the rationale behind these values
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+			}).DialContext,
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+			IdleConnTimeout:       5 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1500 * time.Millisecond,
+		},
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// proxyRequest handles the actual resolution of and then request to the function service.
+// When the function's retry policy allows it, failed attempts are retried against another
+// endpoint of the function. The function's timeout is applied across all attempts.
+// resolved is false when the function could not be found, so that callers do not record
+// metrics for names which do not exist.
+func proxyRequest(w http.ResponseWriter, originalReq *http.Request, proxyClient *http.Client, resolver BaseURLResolver, annotations AnnotationReader, reverseProxy *httputil.ReverseProxy, verbose bool) (resolved bool) {
+	ctx := originalReq.Context()
+
+	pathVars := mux.Vars(originalReq)
+	functionName := pathVars["name"]
+	if functionName == "" {
+		w.Header().Add(openFaaSInternalHeader, "proxy")
+
+		fhttputil.Errorf(w, http.StatusBadRequest, "Provide function name in the request path")
+		return
+	}
+
+	if verbose {
+		start := time.Now()
+		defer func() {
+			seconds := time.Since(start)
+			log.Printf("%s took %f seconds\n", functionName, seconds.Seconds())
+		}()
+	}
+
+	settings := readSettings(functionName, annotations)
+	if settings.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.timeout)
+		defer cancel()
+	}
+
+	if requiresStdlibProxy(originalReq) {
+		functionAddr, err := resolver.ResolveExcluding(functionName, nil)
+		if err != nil {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			log.Printf("resolver error: no endpoints for %s: %s\n", functionName, err.Error())
+			fhttputil.Errorf(w, http.StatusServiceUnavailable, "No endpoints available for: %s.", functionName)
+			return
+		}
+		resolved = true
+
+		proxyReq, err := buildProxyRequest(originalReq, functionAddr, pathVars["params"])
+		if err != nil {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			fhttputil.Errorf(w, http.StatusInternalServerError, "Failed to resolve service: %s.", functionName)
+			return
+		}
+
+		originalReq.URL = proxyReq.URL
+
+		reverseProxy.ServeHTTP(w, originalReq.WithContext(ctx))
+		return
+	}
+
+	policy := settings.retry
+
+	attempts := 1
+	var body []byte
+	if policy.Attempts > 1 && policy.RetriesMethod(originalReq.Method) {
+		buffered, ok, err := bufferBody(originalReq, maxRetryBodyBytes)
+		if err != nil {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			log.Printf("error reading request body for: %s, %s\n", functionName, err.Error())
+			fhttputil.Errorf(w, http.StatusBadRequest, "Unable to read request body for: %s.", functionName)
+			return
+		}
+
+		// bodies which are too large to buffer are sent once, without retries
+		if ok {
+			attempts = policy.Attempts
+			body = buffered
+		}
+	}
+
+	tried := []url.URL{}
+	for attempt := 1; ; attempt++ {
+		functionAddr, err := resolver.ResolveExcluding(functionName, tried)
+		if err != nil {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			// TODO: Should record the 404/not found error in Prometheus.
+			log.Printf("resolver error: no endpoints for %s: %s\n", functionName, err.Error())
+			fhttputil.Errorf(w, http.StatusServiceUnavailable, "No endpoints available for: %s.", functionName)
+			return
+		}
+		resolved = true
+
+		proxyReq, err := buildProxyRequest(originalReq, functionAddr, pathVars["params"])
+		if err != nil {
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			fhttputil.Errorf(w, http.StatusInternalServerError, "Failed to resolve service: %s.", functionName)
+			return
+		}
+
+		if body != nil {
+			proxyReq.Body = io.NopCloser(bytes.NewReader(body))
+			proxyReq.ContentLength = int64(len(body))
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+
+		// the caller may have gone away, in which case there is nobody to retry for
+		lastAttempt := attempt >= attempts || ctx.Err() != nil
+
+		response, err := proxyClient.Do(proxyReq.WithContext(attemptCtx))
+		if err != nil {
+			cancel()
+
+			if !lastAttempt && ctx.Err() == nil {
+				log.Printf("retrying %s, attempt %d/%d failed: %s\n", functionName, attempt, attempts, err.Error())
+				tried = append(tried, functionAddr)
+				continue
+			}
+
+			log.Printf("error with proxy request to: %s, %s\n", proxyReq.URL.String(), err.Error())
+
+			w.Header().Add(openFaaSInternalHeader, "proxy")
+
+			if errors.Is(err, context.DeadlineExceeded) {
+				fhttputil.Errorf(w, http.StatusGatewayTimeout, "Function timed out: %s.", functionName)
+				return
+			}
+
+			fhttputil.Errorf(w, http.StatusInternalServerError, "Can't reach service for: %s.", functionName)
+			return
+		}
+
+		if !lastAttempt && policy.RetriesStatus(response.StatusCode) {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+			cancel()
+
+			log.Printf("retrying %s, attempt %d/%d returned: %d\n", functionName, attempt, attempts, response.StatusCode)
+			tried = append(tried, functionAddr)
+			continue
+		}
+
+		defer cancel()
+		writeResponse(w, originalReq, response)
+		return
+	}
+}
+
+// writeResponse copies the function's response back to the caller
+func writeResponse(w http.ResponseWriter, originalReq *http.Request, response *http.Response) {
+	if response.Body != nil {
+		defer func() {
+			_, _ = io.Copy(io.Discard, response.Body) // drain to EOF
+			_ = response.Body.Close()
+		}()
+	}
+
+	clientHeader := w.Header()
+	copyHeaders(clientHeader, &response.Header)
+	w.Header().Set("Content-Type", getContentType(originalReq.Header, response.Header))
+
+	w.WriteHeader(response.StatusCode)
+	if response.Body != nil {
+		io.Copy(w, response.Body)
+	}
+}
+
+// functionSettings are the proxy settings for a function, read from its annotations
+type functionSettings struct {
+	retry   RetryPolicy
+	timeout time.Duration
+}
+
+// readSettings returns the function's proxy settings. Invalid or missing values fall back
+// to a policy without retries and no timeout beyond that of the proxy client.
+func readSettings(functionName string, annotations AnnotationReader) functionSettings {
+	settings := functionSettings{}
+	settings.retry, _ = ReadRetryPolicy(nil)
+
+	if annotations == nil {
+		return settings
+	}
+
+	// the error is not logged as this runs for every invocation, an unknown function or
+	// namespace is reported once the resolver fails to find it
+	values, err := annotations.Annotations(functionName)
+	if err != nil {
+		return settings
+	}
+
+	if policy, err := ReadRetryPolicy(values); err != nil {
+		log.Printf("invalid retry policy for %s: %s\n", functionName, err.Error())
+	} else {
+		settings.retry = policy
+	}
+
+	if timeout, err := ReadTimeout(values); err != nil {
+		log.Printf("invalid timeout for %s: %s\n", functionName, err.Error())
+	} else {
+		settings.timeout = timeout
+	}
+
+	return settings
+}
+
+// bufferBody reads the request body into memory so that it can be replayed. When the body
+// is larger than limit, ok is false and the request body is restored so that it can be
+// streamed to the function once.
+func bufferBody(r *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(buf)) > limit {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buf), r.Body))
+		return nil, false, nil
+	}
+
+	return buf, true, nil
+}
+
+// requiresStdlibProxy checks if the request should be proxied using the standard library reverse proxy.
+// Support SSE, NDSJON and WebSockets through the stdlib reverse proxy
+func requiresStdlibProxy(req *http.Request) bool {
+	acceptHeader := strings.ToLower(req.Header.Get("Accept"))
+
+	return strings.Contains(acceptHeader, "text/event-stream") ||
+		strings.Contains(acceptHeader, "application/x-ndjson") ||
+		req.Header.Get("Upgrade") == "websocket"
+}
+
+// buildProxyRequest creates a request object for the proxy request, it will ensure that
+// the original request headers are preserved as well as setting openfaas system headers
+func buildProxyRequest(originalReq *http.Request, baseURL url.URL, extraPath string) (*http.Request, error) {
+
+	url := url.URL{
+		Scheme:   baseURL.Scheme,
+		Host:     baseURL.Host,
+		Path:     extraPath,
+		RawQuery: originalReq.URL.RawQuery,
+	}
+
+	upstreamReq, err := http.NewRequest(originalReq.Method, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(upstreamReq.Header, &originalReq.Header)
+
+	if len(originalReq.Host) > 0 && upstreamReq.Header.Get("X-Forwarded-Host") == "" {
+		upstreamReq.Header["X-Forwarded-Host"] = []string{originalReq.Host}
+	}
+	if upstreamReq.Header.Get("X-Forwarded-For") == "" {
+		upstreamReq.Header["X-Forwarded-For"] = []string{originalReq.RemoteAddr}
+	}
+
+	if originalReq.Body != nil {
+		upstreamReq.Body = originalReq.Body
+	}
+
+	return upstreamReq, nil
+}
+
+// copyHeaders clones the header values from the source into the destination.
+func copyHeaders(destination http.Header, source *http.Header) {
+	for k, v := range *source {
+		vClone := make([]string, len(v))
+		copy(vClone, v)
+		destination[k] = vClone
+	}
+}
+
+// getContentType resolves the correct Content-Type for a proxied function.
+func getContentType(request http.Header, proxyResponse http.Header) (headerContentType string) {
+	responseHeader := proxyResponse.Get("Content-Type")
+	requestHeader := request.Get("Content-Type")
+
+	if len(responseHeader) > 0 {
+		headerContentType = responseHeader
+	} else if len(requestHeader) > 0 {
+		headerContentType = requestHeader
+	} else {
+		headerContentType = defaultContentType
+	}
+
+	return headerContentType
+}
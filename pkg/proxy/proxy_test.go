@@ -0,0 +1,266 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/openfaas/faas-provider/types"
+)
+
+type fakeResolver struct {
+	lock     sync.Mutex
+	backends []url.URL
+	excluded [][]url.URL
+}
+
+func (f *fakeResolver) ResolveExcluding(functionName string, exclude []url.URL) (url.URL, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.excluded = append(f.excluded, append([]url.URL{}, exclude...))
+	for _, b := range f.backends {
+		found := false
+		for _, e := range exclude {
+			if e.Host == b.Host {
+				found = true
+			}
+		}
+		if !found {
+			return b, nil
+		}
+	}
+	return f.backends[0], nil
+}
+
+type notFoundResolver struct{}
+
+func (notFoundResolver) ResolveExcluding(functionName string, exclude []url.URL) (url.URL, error) {
+	return url.URL{}, fmt.Errorf("function %s not found", functionName)
+}
+
+type fakeAnnotations map[string]string
+
+func (f fakeAnnotations) Annotations(functionName string) (map[string]string, error) {
+	return f, nil
+}
+
+func newBackend(t *testing.T, handler http.HandlerFunc) url.URL {
+	s := httptest.NewServer(handler)
+	t.Cleanup(s.Close)
+
+	u, _ := url.Parse(s.URL)
+	return *u
+}
+
+func invoke(handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://gateway:8080/function/figlet", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"name": "figlet"})
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func Test_proxy_RetriesOnAnotherEndpoint(t *testing.T) {
+	failing := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	healthy := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "echo: %s", body)
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{failing, healthy}}
+	annotations := fakeAnnotations{
+		RetryAttemptsAnnotation: "3",
+		RetryMethodsAnnotation:  "GET,POST",
+	}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, annotations, nil, false)
+	rr := invoke(handler, http.MethodPost, "hello")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d", http.StatusOK, rr.Code)
+	}
+
+	if got := rr.Body.String(); got != "echo: hello" {
+		t.Fatalf("want body to be replayed, got: %q", got)
+	}
+
+	if len(resolver.excluded) != 2 {
+		t.Fatalf("want 2 resolutions, got: %d", len(resolver.excluded))
+	}
+
+	if len(resolver.excluded[1]) != 1 || resolver.excluded[1][0].Host != failing.Host {
+		t.Fatalf("want failed endpoint to be excluded, got: %v", resolver.excluded[1])
+	}
+}
+
+func Test_proxy_NoRetryForMethodNotInPolicy(t *testing.T) {
+	calls := 0
+	failing := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{failing}}
+	annotations := fakeAnnotations{
+		RetryAttemptsAnnotation: "3",
+	}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, annotations, nil, false)
+	rr := invoke(handler, http.MethodPost, "hello")
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	if calls != 1 {
+		t.Fatalf("want 1 call for a POST without it being retryable, got: %d", calls)
+	}
+}
+
+func Test_proxy_ReturnsLastResponseWhenAttemptsExhausted(t *testing.T) {
+	calls := 0
+	failing := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{failing}}
+	annotations := fakeAnnotations{
+		RetryAttemptsAnnotation: "3",
+	}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, annotations, nil, false)
+	rr := invoke(handler, http.MethodGet, "")
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	if calls != 3 {
+		t.Fatalf("want 3 calls, got: %d", calls)
+	}
+}
+
+func Test_proxy_RetriesAfterAttemptTimeout(t *testing.T) {
+	slow := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	healthy := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{slow, healthy}}
+	annotations := fakeAnnotations{
+		RetryAttemptsAnnotation: "2",
+		RetryTimeoutAnnotation:  "50ms",
+	}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, annotations, nil, false)
+	rr := invoke(handler, http.MethodGet, "")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("want status: %d, got: %d", http.StatusOK, rr.Code)
+	}
+}
+
+func Test_bufferBody_TooLarge(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://gateway:8080/function/figlet", strings.NewReader("0123456789"))
+	req.ContentLength = -1
+
+	_, ok, err := bufferBody(req, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Fatalf("want body to be too large to buffer")
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "0123456789" {
+		t.Fatalf("want the original body to be restored, got: %q", string(body))
+	}
+}
+
+func Test_proxy_FunctionTimeoutReturnsGatewayTimeout(t *testing.T) {
+	slow := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{slow}}
+	annotations := fakeAnnotations{
+		TimeoutAnnotation: "50ms",
+	}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, annotations, nil, false)
+	rr := invoke(handler, http.MethodGet, "")
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("want status: %d, got: %d", http.StatusGatewayTimeout, rr.Code)
+	}
+}
+
+type fakeRecorder struct {
+	functionName string
+	code         int
+}
+
+func (f *fakeRecorder) Observe(functionName string, code int, duration time.Duration) {
+	f.functionName = functionName
+	f.code = code
+}
+
+func Test_proxy_RecordsInvocation(t *testing.T) {
+	backend := newBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	resolver := &fakeResolver{backends: []url.URL{backend}}
+	recorder := &fakeRecorder{}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, resolver, nil, recorder, false)
+	invoke(handler, http.MethodGet, "")
+
+	if recorder.functionName != "figlet" {
+		t.Errorf("want function: figlet, got: %q", recorder.functionName)
+	}
+
+	if recorder.code != http.StatusCreated {
+		t.Errorf("want code: %d, got: %d", http.StatusCreated, recorder.code)
+	}
+}
+
+func Test_proxy_DoesNotRecordUnknownFunctions(t *testing.T) {
+	recorder := &fakeRecorder{}
+
+	handler := NewHandlerFunc(types.FaaSConfig{}, notFoundResolver{}, nil, recorder, false)
+	rr := invoke(handler, http.MethodGet, "")
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want status: %d, got: %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	if recorder.functionName != "" {
+		t.Errorf("want no invocation recorded for an unknown function, got: %q", recorder.functionName)
+	}
+}
@@ -0,0 +1,166 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RetryAttemptsAnnotation is the maximum number of attempts made for an invocation,
+	// including the first one. A value of 1 disables retries.
+	RetryAttemptsAnnotation = "com.openfaas.retry.attempts"
+
+	// RetryMethodsAnnotation is a comma separated list of HTTP methods which are
+	// safe to retry for the function.
+	RetryMethodsAnnotation = "com.openfaas.retry.methods"
+
+	// RetryCodesAnnotation is a comma separated list of HTTP status codes returned
+	// by the function which should be retried.
+	RetryCodesAnnotation = "com.openfaas.retry.codes"
+
+	// RetryTimeoutAnnotation is the timeout applied to each attempt, given as
+	// a Go duration i.e. "2s".
+	RetryTimeoutAnnotation = "com.openfaas.retry.timeout"
+
+	// maxRetryAttempts caps the attempts that can be requested through annotations
+	maxRetryAttempts = 10
+
+	// maxRetryBodyBytes is the largest request body that will be buffered in memory
+	// so that it can be replayed. Larger requests are sent once without retries.
+	maxRetryBodyBytes = 256 * 1024
+)
+
+// defaultRetryMethods are idempotent and can be retried without side-effects
+var defaultRetryMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+}
+
+// defaultRetryCodes are the status codes typically seen when a replica is being
+// terminated or is not yet ready during a rollout
+var defaultRetryCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy describes how the proxy retries a failed invocation of a function
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one
+	Attempts int
+
+	// Methods which may be retried
+	Methods []string
+
+	// StatusCodes returned by the function which are retried
+	StatusCodes []int
+
+	// Timeout for each attempt, zero means no per-attempt timeout
+	Timeout time.Duration
+}
+
+// ReadRetryPolicy parses the retry policy for a function from its annotations.
+// When no attempts are configured, the policy has a single attempt.
+func ReadRetryPolicy(annotations map[string]string) (RetryPolicy, error) {
+	policy := RetryPolicy{
+		Attempts:    1,
+		Methods:     defaultRetryMethods,
+		StatusCodes: defaultRetryCodes,
+	}
+
+	if v, ok := annotations[RetryAttemptsAnnotation]; ok {
+		attempts, err := strconv.Atoi(v)
+		if err != nil {
+			return policy, fmt.Errorf("%s: %q is not a valid integer", RetryAttemptsAnnotation, v)
+		}
+		if attempts < 1 || attempts > maxRetryAttempts {
+			return policy, fmt.Errorf("%s: must be between 1 and %d", RetryAttemptsAnnotation, maxRetryAttempts)
+		}
+		policy.Attempts = attempts
+	}
+
+	if v, ok := annotations[RetryMethodsAnnotation]; ok {
+		methods := []string{}
+		for _, m := range strings.Split(v, ",") {
+			method := strings.ToUpper(strings.TrimSpace(m))
+			if len(method) == 0 {
+				continue
+			}
+			if !isProxiedMethod(method) {
+				return policy, fmt.Errorf("%s: %q is not a supported method", RetryMethodsAnnotation, method)
+			}
+			methods = append(methods, method)
+		}
+		policy.Methods = methods
+	}
+
+	if v, ok := annotations[RetryCodesAnnotation]; ok {
+		codes := []int{}
+		for _, c := range strings.Split(v, ",") {
+			c = strings.TrimSpace(c)
+			if len(c) == 0 {
+				continue
+			}
+			code, err := strconv.Atoi(c)
+			if err != nil || code < 100 || code > 599 {
+				return policy, fmt.Errorf("%s: %q is not a valid status code", RetryCodesAnnotation, c)
+			}
+			codes = append(codes, code)
+		}
+		policy.StatusCodes = codes
+	}
+
+	if v, ok := annotations[RetryTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return policy, fmt.Errorf("%s: %q is not a valid duration", RetryTimeoutAnnotation, v)
+		}
+		if timeout < 0 {
+			return policy, fmt.Errorf("%s: must not be negative", RetryTimeoutAnnotation)
+		}
+		policy.Timeout = timeout
+	}
+
+	return policy, nil
+}
+
+// RetriesMethod returns true when requests with the given method may be retried
+func (p RetryPolicy) RetriesMethod(method string) bool {
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// RetriesStatus returns true when a response with the given status code may be retried
+func (p RetryPolicy) RetriesStatus(code int) bool {
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func isProxiedMethod(method string) bool {
+	switch method {
+	case http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+		http.MethodGet,
+		http.MethodOptions,
+		http.MethodHead:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_ReadRetryPolicy_Defaults(t *testing.T) {
+	policy, err := ReadRetryPolicy(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Attempts != 1 {
+		t.Errorf("want attempts: 1, got: %d", policy.Attempts)
+	}
+
+	if !policy.RetriesMethod(http.MethodGet) || policy.RetriesMethod(http.MethodPost) {
+		t.Errorf("want only idempotent methods to be retried, got: %v", policy.Methods)
+	}
+
+	if !policy.RetriesStatus(http.StatusBadGateway) || policy.RetriesStatus(http.StatusInternalServerError) {
+		t.Errorf("want only gateway errors to be retried, got: %v", policy.StatusCodes)
+	}
+}
+
+func Test_ReadRetryPolicy_FromAnnotations(t *testing.T) {
+	policy, err := ReadRetryPolicy(map[string]string{
+		RetryAttemptsAnnotation: "4",
+		RetryMethodsAnnotation:  "get, post",
+		RetryCodesAnnotation:    "500,429",
+		RetryTimeoutAnnotation:  "1500ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Attempts != 4 {
+		t.Errorf("want attempts: 4, got: %d", policy.Attempts)
+	}
+
+	if !policy.RetriesMethod(http.MethodPost) {
+		t.Errorf("want POST to be retried, got: %v", policy.Methods)
+	}
+
+	if !policy.RetriesStatus(http.StatusTooManyRequests) || policy.RetriesStatus(http.StatusBadGateway) {
+		t.Errorf("want codes to be overridden, got: %v", policy.StatusCodes)
+	}
+
+	if policy.Timeout != 1500*time.Millisecond {
+		t.Errorf("want timeout: 1.5s, got: %s", policy.Timeout)
+	}
+}
+
+func Test_ReadRetryPolicy_Invalid(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{"attempts not a number", map[string]string{RetryAttemptsAnnotation: "three"}},
+		{"attempts too low", map[string]string{RetryAttemptsAnnotation: "0"}},
+		{"attempts too high", map[string]string{RetryAttemptsAnnotation: "100"}},
+		{"unknown method", map[string]string{RetryMethodsAnnotation: "GET,CONNECT"}},
+		{"invalid code", map[string]string{RetryCodesAnnotation: "50x"}},
+		{"code out of range", map[string]string{RetryCodesAnnotation: "700"}},
+		{"invalid timeout", map[string]string{RetryTimeoutAnnotation: "soon"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ReadRetryPolicy(tc.annotations); err == nil {
+				t.Fatalf("want error for %v", tc.annotations)
+			}
+		})
+	}
+}
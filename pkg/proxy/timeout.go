@@ -0,0 +1,38 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeoutAnnotation is the maximum duration of an invocation of the function, given
+// as a Go duration i.e. "30s" or as a number of seconds.
+const TimeoutAnnotation = "com.openfaas.timeout"
+
+// ReadTimeout parses the invocation timeout for a function from its annotations. A
+// zero duration is returned when no timeout is set.
+func ReadTimeout(annotations map[string]string) (time.Duration, error) {
+	v, ok := annotations[TimeoutAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(v)
+	if err != nil {
+		seconds, intErr := strconv.Atoi(v)
+		if intErr != nil {
+			return 0, fmt.Errorf("%s: %q is not a valid duration", TimeoutAnnotation, v)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("%s: must be greater than zero", TimeoutAnnotation)
+	}
+
+	return timeout, nil
+}
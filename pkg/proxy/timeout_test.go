@@ -0,0 +1,55 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ReadTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "duration", value: "1m30s", want: 90 * time.Second},
+		{name: "seconds", value: "45", want: 45 * time.Second},
+		{name: "zero", value: "0s", wantErr: true},
+		{name: "negative", value: "-5s", wantErr: true},
+		{name: "invalid", value: "forever", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ReadTimeout(map[string]string{TimeoutAnnotation: tc.value})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error for %q", tc.value)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ReadTimeout_NotSet(t *testing.T) {
+	got, err := ReadTimeout(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != 0 {
+		t.Fatalf("want no timeout, got: %s", got)
+	}
+}
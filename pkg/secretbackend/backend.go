@@ -0,0 +1,66 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+// Package secretbackend stores function secrets outside of Kubernetes. The values held
+// by a backend are the source of truth, and are copied into Kubernetes Secrets so that
+// they can be mounted into functions.
+package secretbackend
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when a secret does not exist within the backend
+var ErrNotFound = errors.New("secret not found")
+
+// Backend is a store for function secrets, each secret holds one or more keys
+type Backend interface {
+	// Name identifies the backend, i.e. "vault" or "file"
+	Name() string
+
+	// List returns the names of the secrets in the namespace
+	List(namespace string) ([]string, error)
+
+	// Get returns the data of a secret, or ErrNotFound
+	Get(namespace, name string) (map[string][]byte, error)
+
+	// Put creates or replaces a secret
+	Put(namespace, name string, data map[string][]byte) error
+
+	// Delete removes a secret, or returns ErrNotFound
+	Delete(namespace, name string) error
+}
+
+// Config selects and configures a Backend
+type Config struct {
+	// Backend is "file" or "vault"
+	Backend string
+
+	// FileDir is the directory used by the file backend
+	FileDir string
+
+	// VaultAddr is the address of the Vault server, i.e. http://127.0.0.1:8200
+	VaultAddr string
+
+	// VaultToken authenticates to Vault
+	VaultToken string
+
+	// VaultMount is the path of the KV version 2 secrets engine
+	VaultMount string
+
+	// VaultPrefix is prepended to the path of each secret within the mount
+	VaultPrefix string
+}
+
+// New creates the Backend named in the config
+func New(cfg Config) (Backend, error) {
+	switch cfg.Backend {
+	case "file":
+		return NewFileBackend(cfg.FileDir)
+	case "vault":
+		return NewVaultBackend(cfg.VaultAddr, cfg.VaultToken, cfg.VaultMount, cfg.VaultPrefix)
+	default:
+		return nil, fmt.Errorf("unknown secret backend: %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,171 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package secretbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// FileBackend stores each secret as a JSON file at <dir>/<namespace>/<name>.json, with
+// its values encoded as base64. Files are only readable by the owner.
+type FileBackend struct {
+	dir  string
+	lock sync.Mutex
+}
+
+// NewFileBackend creates a FileBackend, creating the directory when needed
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if dir == "" {
+		return nil, errors.New("a directory is required for the file secret backend")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileBackend{dir: dir}, nil
+}
+
+// Name returns "file"
+func (b *FileBackend) Name() string {
+	return "file"
+}
+
+// List returns the names of the secrets in the namespace
+func (b *FileBackend) List(namespace string) ([]string, error) {
+	dir, err := b.namespaceDir(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Get returns the data of a secret
+func (b *FileBackend) Get(namespace, name string) (map[string][]byte, error) {
+	path, err := b.path(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// Put writes the secret to a temporary file and renames it, so that readers never see
+// a partially written secret
+func (b *FileBackend) Put(namespace, name string, data map[string][]byte) error {
+	path, err := b.path(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Delete removes a secret
+func (b *FileBackend) Delete(namespace, name string) error {
+	path, err := b.path(namespace, name)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// path validates the namespace and name, so that they can not escape the directory
+func (b *FileBackend) path(namespace, name string) (string, error) {
+	dir, err := b.namespaceDir(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid secret name %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func (b *FileBackend) namespaceDir(namespace string) (string, error) {
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+
+	return filepath.Join(b.dir, namespace), nil
+}
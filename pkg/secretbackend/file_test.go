@@ -0,0 +1,91 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package secretbackend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_FileBackend_PutGetListDelete(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string][]byte{"tls.crt": []byte("cert"), "tls.key": {0x00, 0xff}}
+	if err := b.Put("openfaas-fn", "tls", want); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := b.Put("openfaas-fn", "api-key", map[string][]byte{"api-key": []byte("abc")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := b.Get("openfaas-fn", "tls")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "openfaas-fn", "tls.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("want file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	names, err := b.List("openfaas-fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual([]string{"api-key", "tls"}, names) {
+		t.Fatalf("want api-key and tls, got %v", names)
+	}
+
+	if err := b.Delete("openfaas-fn", "tls"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := b.Get("openfaas-fn", "tls"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound after delete, got %v", err)
+	}
+	if err := b.Delete("openfaas-fn", "tls"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound deleting a missing secret, got %v", err)
+	}
+}
+
+func Test_FileBackend_ListMissingNamespace(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	names, err := b.List("staging")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("want no secrets, got %v", names)
+	}
+}
+
+func Test_FileBackend_RejectsPathTraversal(t *testing.T) {
+	b, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := b.Put("openfaas-fn", "../../etc/passwd", map[string][]byte{"a": []byte("b")}); err == nil {
+		t.Fatal("want error for a name containing a path")
+	}
+	if _, err := b.List("../openfaas-fn"); err == nil {
+		t.Fatal("want error for a namespace containing a path")
+	}
+}
@@ -0,0 +1,179 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package secretbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VaultBackend stores secrets in the KV version 2 secrets engine of HashiCorp Vault, at
+// <mount>/<prefix>/<namespace>/<name>. Each key of a secret is stored as a string field,
+// so that secrets can also be written with the vault CLI, and binary values are rejected.
+type VaultBackend struct {
+	addr   string
+	token  string
+	mount  string
+	prefix string
+	client *http.Client
+}
+
+// NewVaultBackend creates a VaultBackend, the mount defaults to "secret"
+func NewVaultBackend(addr, token, mount, prefix string) (*VaultBackend, error) {
+	if addr == "" {
+		return nil, errors.New("an address is required for the vault secret backend")
+	}
+
+	if token == "" {
+		return nil, errors.New("a token is required for the vault secret backend")
+	}
+
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &VaultBackend{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		prefix: strings.Trim(prefix, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns "vault"
+func (b *VaultBackend) Name() string {
+	return "vault"
+}
+
+// List returns the names of the secrets in the namespace
+func (b *VaultBackend) List(namespace string) ([]string, error) {
+	res := struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}{}
+
+	if err := b.do("LIST", b.url("metadata", namespace, ""), nil, &res); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	for _, key := range res.Data.Keys {
+		// keys ending in a slash are nested paths rather than secrets
+		if !strings.HasSuffix(key, "/") {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Get returns the data of the latest version of a secret
+func (b *VaultBackend) Get(namespace, name string) (map[string][]byte, error) {
+	res := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+
+	if err := b.do(http.MethodGet, b.url("data", namespace, name), nil, &res); err != nil {
+		return nil, err
+	}
+
+	// a version which has been deleted is returned without data
+	if res.Data.Data == nil {
+		return nil, ErrNotFound
+	}
+
+	data := make(map[string][]byte, len(res.Data.Data))
+	for key, value := range res.Data.Data {
+		data[key] = []byte(value)
+	}
+
+	return data, nil
+}
+
+// Put writes a new version of a secret
+func (b *VaultBackend) Put(namespace, name string, data map[string][]byte) error {
+	values := make(map[string]string, len(data))
+	for key, value := range data {
+		if !utf8.Valid(value) {
+			return fmt.Errorf("the vault secret backend does not support binary values, key: %q", key)
+		}
+		values[key] = string(value)
+	}
+
+	return b.do(http.MethodPost, b.url("data", namespace, name), map[string]interface{}{"data": values}, nil)
+}
+
+// Delete removes all versions of a secret
+func (b *VaultBackend) Delete(namespace, name string) error {
+	if _, err := b.Get(namespace, name); err != nil {
+		return err
+	}
+
+	return b.do(http.MethodDelete, b.url("metadata", namespace, name), nil, nil)
+}
+
+func (b *VaultBackend) url(kind, namespace, name string) string {
+	return b.addr + "/v1/" + path.Join(b.mount, kind, b.prefix, url.PathEscape(namespace), url.PathEscape(name))
+}
+
+// do sends the request to Vault and decodes the response into out, when given. A 404
+// response is returned as ErrNotFound.
+func (b *VaultBackend) do(method, u string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", b.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("vault returned %d for %s %s: %s", res.StatusCode, method, req.URL.Path, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
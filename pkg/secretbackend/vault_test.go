@@ -0,0 +1,150 @@
+// License: OpenFaaS Community Edition (CE) EULA
+// Copyright (c) 2017,2019-2024 OpenFaaS Author(s)
+
+package secretbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault implements the parts of the KV version 2 API used by the VaultBackend
+type fakeVault struct {
+	lock    sync.Mutex
+	secrets map[string]map[string]string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "root" {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := v.secrets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case http.MethodPost:
+			body := struct {
+				Data map[string]string `json:"data"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			v.secrets[key] = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+		switch r.Method {
+		case "LIST":
+			keys := []string{}
+			for k := range v.secrets {
+				if strings.HasPrefix(k, key+"/") {
+					keys = append(keys, strings.TrimPrefix(k, key+"/"))
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case http.MethodDelete:
+			delete(v.secrets, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func Test_VaultBackend_PutGetListDelete(t *testing.T) {
+	vault := &fakeVault{secrets: map[string]map[string]string{}}
+	srv := httptest.NewServer(vault)
+	defer srv.Close()
+
+	b, err := NewVaultBackend(srv.URL, "root", "", "openfaas")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string][]byte{"username": []byte("admin"), "password": []byte("s3cr3t")}
+	if err := b.Put("openfaas-fn", "db", want); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, ok := vault.secrets["openfaas/openfaas-fn/db"]; !ok {
+		t.Fatalf("want secret written to openfaas/openfaas-fn/db, got %v", vault.secrets)
+	}
+
+	got, err := b.Get("openfaas-fn", "db")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	names, err := b.List("openfaas-fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual([]string{"db"}, names) {
+		t.Fatalf("want db, got %v", names)
+	}
+
+	if err := b.Delete("openfaas-fn", "db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := b.Get("openfaas-fn", "db"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound after delete, got %v", err)
+	}
+
+	names, err = b.List("openfaas-fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("want no secrets, got %v", names)
+	}
+}
+
+func Test_VaultBackend_RejectsBinaryValues(t *testing.T) {
+	b, err := NewVaultBackend("http://127.0.0.1:8200", "root", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := b.Put("openfaas-fn", "key", map[string][]byte{"key": {0xff, 0xfe}}); err == nil {
+		t.Fatal("want error for a binary value")
+	}
+}
+
+func Test_VaultBackend_ReportsErrors(t *testing.T) {
+	srv := httptest.NewServer(&fakeVault{secrets: map[string]map[string]string{}})
+	defer srv.Close()
+
+	b, err := NewVaultBackend(srv.URL, "wrong", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = b.Get("openfaas-fn", "db")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("want a 403 error, got %v", err)
+	}
+}